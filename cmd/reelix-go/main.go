@@ -1,18 +1,40 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"reelix-go/internal/api"
 	"reelix-go/internal/db"
 	"reelix-go/internal/scanner"
+	"reelix-go/internal/thumbnail"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultQueryTimeout   = 30 * time.Second
+	defaultRequestTimeout = 60 * time.Second
 )
 
 func main() {
+	full := flag.Bool("full", false, "re-read every folder, even the ones that haven't changed, on startup and whenever the watcher re-scans the library")
+	flag.Parse()
+
+	// Stop scanning and serving on Ctrl-C or when the container stops.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Connect to DB
 	dbURL := fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s",
@@ -23,10 +45,11 @@ func main() {
 		os.Getenv("DB_NAME"),
 	)
 
+	var pool *pgxpool.Pool
 	var err error
 
 	for i := 1; i <= 30; i++ {
-		_, err = db.Connect(dbURL)
+		pool, err = db.Connect(ctx, dbURL)
 
 		if err == nil {
 			break
@@ -40,15 +63,156 @@ func main() {
 		log.Fatal("failed to connect to database after 30 retries:", err)
 	}
 
-	defer db.Close()
+	defer pool.Close()
+
+	// Every call into the database and every API request are bounded,
+	// so a stuck query doesn't hold on to a connection for good.
+	queryTimeout, err := envDuration("QUERY_TIMEOUT", defaultQueryTimeout)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	requestTimeout, err := envDuration("REQUEST_TIMEOUT", defaultRequestTimeout)
 
-	root := "/reelix"
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	world, _ := scanner.Scan(root)
-	scanner.Sync(world)
+	db.SetQueryTimeout(queryTimeout)
 
-	router := api.NewRouter()
+	// reelix-go migrate up|down|status manages the schema and exits.
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(ctx, pool, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if flag.NArg() > 0 {
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+
+	// Bring the schema up to date before anything touches it, unless
+	// migrations are run by hand.
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		if _, err := db.MigrateUp(ctx, pool); err != nil {
+			log.Fatal("failed to migrate database:", err)
+		}
+	}
+
+	store := db.NewPostgres(pool)
+
+	library := scanner.DefaultLibrary("/reelix")
+
+	if configPath := os.Getenv("LIBRARY_CONFIG"); configPath != "" {
+		library, err = scanner.LoadLibrary(configPath)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	opts := scanner.Options{}
+
+	if workers := os.Getenv("SCAN_WORKERS"); workers != "" {
+		opts.Workers, err = strconv.Atoi(workers)
+
+		if err != nil {
+			log.Fatal("invalid SCAN_WORKERS:", err)
+		}
+	}
+
+	opts.FullHash = os.Getenv("HASH_FULL") == "true"
+
+	if providers := os.Getenv("METADATA_PROVIDERS"); providers != "" {
+		opts.Providers, err = scanner.NewProviders(strings.Split(providers, ","), os.Getenv("METADATA_PATTERN"))
+
+		if err != nil {
+			log.Fatal("invalid METADATA_PROVIDERS:", err)
+		}
+	}
+
+	// Only folders that changed since they were last read are read
+	// again, unless a full scan was asked for. The same goes for the
+	// watcher when it has to re-scan the whole library.
+	opts.SkipUnchanged = !*full
+
+	world, report, err := scanner.Scan(ctx, library, opts, store)
+
+	if err := scanner.SyncReport(ctx, report, store); err != nil {
+		log.Println("scan report sync error:", err)
+	}
+
+	if err != nil {
+		log.Println("scan error:", err)
+	} else {
+		if err := scanner.Sync(ctx, world, store); err != nil {
+			log.Println("sync error:", err)
+		}
+
+		// Only a complete scan tells us what is gone from disk.
+		pruned, err := scanner.Reconcile(ctx, world, store)
+
+		if err != nil {
+			log.Println("reconcile error:", err)
+		}
+
+		log.Printf("pruned %v", pruned)
+	}
+
+	// Keep the database in step with the library while we run,
+	// unless watching has been turned off (e.g. on mounts that
+	// don't support inotify).
+	if os.Getenv("WATCH") != "false" {
+		go func() {
+			if err := scanner.Watch(ctx, library, opts, store); err != nil {
+				log.Println("watcher stopped:", err)
+			}
+		}()
+	}
+
+	thumbDir := os.Getenv("THUMB_CACHE_DIR")
+
+	if thumbDir == "" {
+		thumbDir = filepath.Join(os.TempDir(), "reelix-thumbs")
+	}
+
+	if err := thumbnail.Init(thumbDir); err != nil {
+		log.Fatal(err)
+	}
+
+	router := api.NewRouter(store, api.Options{RequestTimeout: requestTimeout})
+
+	server := &http.Server{Addr: ":8081", Handler: router}
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
 
 	fmt.Println("Reelix video server started on http://localhost:8081")
-	log.Fatal(http.ListenAndServe(":8081", router))
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// envDuration reads a duration such as 30s from the environment, falling
+// back to def when it is not set. Zero turns the timeout off.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	return d, nil
 }
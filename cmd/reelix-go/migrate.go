@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"reelix-go/internal/db"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrate runs the migrate subcommand: up applies every pending
+// migration, down undoes the latest one and status lists them all.
+func migrate(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: reelix-go migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx, pool)
+
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		undone, err := db.MigrateDown(ctx, pool)
+
+		if err != nil {
+			return err
+		}
+
+		if undone == nil {
+			fmt.Println("no migrations to undo")
+		} else {
+			fmt.Printf("undone %04d_%s\n", undone.Version, undone.Name)
+		}
+	case "status":
+		statuses, err := db.GetMigrationStatus(ctx, pool)
+
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		for _, s := range statuses {
+			applied := "pending"
+
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Local().Format(time.DateTime)
+			}
+
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"reelix-go/internal/thumbnail"
+)
+
+// findArchiveEntry opens a zip archive and looks up one of its files.
+// The caller has to close the archive.
+func findArchiveEntry(archivePath string, name string) (*zip.ReadCloser, *zip.File, error) {
+	zr, err := zip.OpenReader(archivePath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range zr.File {
+		if f.Name == name {
+			return zr, f, nil
+		}
+	}
+
+	zr.Close()
+
+	return nil, nil, fmt.Errorf("%v not found in %v", name, archivePath)
+}
+
+// serveArchiveEntry streams a single file out of a zip archive without
+// extracting anything to disk.
+func serveArchiveEntry(w http.ResponseWriter, archivePath string, name string) {
+	zr, f, err := findArchiveEntry(archivePath, name)
+
+	if err != nil {
+		log.Printf("error opening archive entry: %v", err)
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	defer zr.Close()
+
+	rc, err := f.Open()
+
+	if err != nil {
+		log.Printf("error reading %v from %v: %v", name, archivePath, err)
+		http.Error(w, "Unable to read page", http.StatusInternalServerError)
+		return
+	}
+
+	defer rc.Close()
+
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatUint(f.UncompressedSize64, 10))
+
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("error streaming %v from %v: %v", name, archivePath, err)
+	}
+}
+
+// archiveThumbSource is a thumbnail source for an image inside an
+// archive. Entries are only as new as the archive they are in.
+func archiveThumbSource(key string, archivePath string, name string, orientation int) (thumbnail.Source, error) {
+	info, err := os.Stat(archivePath)
+
+	if err != nil {
+		return thumbnail.Source{}, err
+	}
+
+	return thumbnail.Source{
+		Key:         key,
+		ModTime:     info.ModTime(),
+		Orientation: orientation,
+		Open: func() (io.ReadCloser, error) {
+			zr, f, err := findArchiveEntry(archivePath, name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			rc, err := f.Open()
+
+			if err != nil {
+				zr.Close()
+				return nil, err
+			}
+
+			return archiveEntryReader{rc, zr}, nil
+		},
+	}, nil
+}
+
+// archiveEntryReader closes the archive together with the entry.
+type archiveEntryReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (r archiveEntryReader) Close() error {
+	r.ReadCloser.Close()
+	return r.archive.Close()
+}
@@ -1,12 +1,20 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"reelix-go/internal/db"
+	"reelix-go/internal/subtitle"
+	"reelix-go/internal/thumbnail"
 
 	"github.com/gorilla/mux"
 )
@@ -15,6 +23,38 @@ type StatusMetadata struct {
 	Status string `json:"status"`
 }
 
+// GalleryImagesPage is one page of the images of a gallery.
+type GalleryImagesPage struct {
+	Images []db.GalleryImage `json:"images"`
+	Page   int               `json:"page"`
+	Limit  int               `json:"limit"`
+	Total  int               `json:"total"`
+}
+
+const (
+	defaultImagesLimit = 100
+	maxImagesLimit     = 500
+)
+
+// handlers serves the API out of a store.
+type handlers struct {
+	store db.Store
+}
+
+// storeError responds to a failed store call with message and status,
+// unless it failed for running out of time: a request that took too long
+// is answered with 503 and a query that did with 504.
+func storeError(w http.ResponseWriter, r *http.Request, err error, message string, status int) {
+	switch {
+	case r.Context().Err() != nil:
+		http.Error(w, "Request timed out", http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Database query timed out", http.StatusGatewayTimeout)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
 func statusHandler(w http.ResponseWriter, r *http.Request) {
 	data := StatusMetadata{
 		Status: "OK",
@@ -28,11 +68,13 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func vaultsHandler(w http.ResponseWriter, r *http.Request) {
-	vaults, err := db.GetVaults()
+func (h *handlers) vaultsHandler(w http.ResponseWriter, r *http.Request) {
+	vaults, err := h.store.GetVaults(r.Context())
 
 	if err != nil {
-		log.Fatalf("error fetching vaults")
+		log.Printf("error fetching vaults: %v", err)
+		storeError(w, r, err, "Unable to fetch vaults", http.StatusInternalServerError)
+		return
 	}
 
 	// Respond with the metadata as JSON
@@ -43,19 +85,22 @@ func vaultsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func vaultHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) vaultHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	vaultId, err := strconv.Atoi(vars["vaultId"])
 
 	if err != nil {
-		log.Fatalf("invalid vault id")
+		http.Error(w, "Invalid vault id", http.StatusBadRequest)
+		return
 	}
 
-	vault, err := db.GetVault(vaultId)
+	vault, err := h.store.GetVault(r.Context(), vaultId)
 
 	if err != nil {
-		log.Fatalf("error fetching vault")
+		log.Printf("error fetching vault %v: %v", vaultId, err)
+		storeError(w, r, err, "Vault not found", http.StatusNotFound)
+		return
 	}
 
 	// Respond with the metadata as JSON
@@ -66,19 +111,22 @@ func vaultHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func collectionsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) collectionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	vaultId, err := strconv.Atoi(vars["vaultId"])
 
 	if err != nil {
-		log.Fatalf("invalid vault id")
+		http.Error(w, "Invalid vault id", http.StatusBadRequest)
+		return
 	}
 
-	collections, err := db.GetCollections(vaultId)
+	collections, err := h.store.GetCollections(r.Context(), vaultId)
 
 	if err != nil {
-		log.Fatalf("error fetching collections from vault %v", vaultId)
+		log.Printf("error fetching collections from vault %v: %v", vaultId, err)
+		storeError(w, r, err, "Unable to fetch collections", http.StatusInternalServerError)
+		return
 	}
 
 	// Respond with the metadata as JSON
@@ -89,19 +137,22 @@ func collectionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func videosHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) videosHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	collectionId, err := strconv.Atoi(vars["collectionId"])
 
 	if err != nil {
-		log.Fatalf("invalid collection id")
+		http.Error(w, "Invalid collection id", http.StatusBadRequest)
+		return
 	}
 
-	videos, err := db.GetVideos(collectionId)
+	videos, err := h.store.GetVideos(r.Context(), collectionId)
 
 	if err != nil {
-		log.Fatalf("error fetching videos from collection %v", collectionId)
+		log.Printf("error fetching videos from collection %v: %v", collectionId, err)
+		storeError(w, r, err, "Unable to fetch videos", http.StatusInternalServerError)
+		return
 	}
 
 	// Respond with the metadata as JSON
@@ -112,19 +163,22 @@ func videosHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func videoHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) videoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	videoId, err := strconv.Atoi(vars["videoId"])
 
 	if err != nil {
-		log.Fatalf("invalid video id")
+		http.Error(w, "Invalid video id", http.StatusBadRequest)
+		return
 	}
 
-	video, err := db.GetVideo(videoId)
+	video, err := h.store.GetVideo(r.Context(), videoId)
 
 	if err != nil {
-		log.Fatalf("error fetching video %v", videoId)
+		log.Printf("error fetching video %v: %v", videoId, err)
+		storeError(w, r, err, "Video not found", http.StatusNotFound)
+		return
 	}
 
 	// Respond with the metadata as JSON
@@ -135,22 +189,31 @@ func videoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func actorsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) actorsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	vaultId, err := strconv.Atoi(vars["vaultId"])
 
 	if err != nil {
-		log.Fatalf("invalid vault id")
+		http.Error(w, "Invalid vault id", http.StatusBadRequest)
+		return
 	}
 
-	vault, err := db.GetVault(vaultId)
+	vault, err := h.store.GetVault(r.Context(), vaultId)
 
 	if err != nil {
-		log.Fatalf("error fetching vault %v", vaultId)
+		log.Printf("error fetching vault %v: %v", vaultId, err)
+		storeError(w, r, err, "Vault not found", http.StatusNotFound)
+		return
 	}
 
-	actors, err := db.GetActors(vaultId)
+	actors, err := h.store.GetActors(r.Context(), vaultId)
+
+	if err != nil {
+		log.Printf("error fetching actors from vault %v: %v", vaultId, err)
+		storeError(w, r, err, "Unable to fetch actors", http.StatusInternalServerError)
+		return
+	}
 
 	type ActorsMetadata struct {
 		Actors    []db.Actor `json:"actors"`
@@ -162,28 +225,73 @@ func actorsHandler(w http.ResponseWriter, r *http.Request) {
 		VaultName: vault.Name,
 	}
 
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
+	}
+}
+
+// ActorDetails is an actor with their metadata and the videos they
+// appear in.
+type ActorDetails struct {
+	*db.Actor
+	Videos []db.ActorVideo `json:"videos"`
+}
+
+func (h *handlers) actorHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	actorId, err := strconv.Atoi(vars["actorId"])
+
+	if err != nil {
+		http.Error(w, "Invalid actor id", http.StatusBadRequest)
+		return
+	}
+
+	actor, err := h.store.GetActorByID(r.Context(), actorId)
+
+	if err != nil {
+		log.Printf("error fetching actor %v: %v", actorId, err)
+		storeError(w, r, err, "Actor not found", http.StatusNotFound)
+		return
+	}
+
+	videos, err := h.store.GetActorVideos(r.Context(), actorId)
+
 	if err != nil {
-		log.Fatalf("error fetching actors from vault %v", vaultId)
+		log.Printf("error fetching videos of actor %v: %v", actorId, err)
+		storeError(w, r, err, "Unable to fetch videos", http.StatusInternalServerError)
+		return
 	}
 
+	data := ActorDetails{
+		Actor:  actor,
+		Videos: videos,
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
 	}
 }
 
-func galleriesHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) galleriesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	vaultId, err := strconv.Atoi(vars["vaultId"])
 
 	if err != nil {
-		log.Fatalf("invalid vault id")
+		http.Error(w, "Invalid vault id", http.StatusBadRequest)
+		return
 	}
 
-	galleries, err := db.GetGalleries(vaultId)
+	galleries, err := h.store.GetGalleries(r.Context(), vaultId)
 
 	if err != nil {
-		log.Fatalf("error fetching galleries from vault %v", vaultId)
+		log.Printf("error fetching galleries from vault %v: %v", vaultId, err)
+		storeError(w, r, err, "Unable to fetch galleries", http.StatusInternalServerError)
+		return
 	}
 
 	if err := json.NewEncoder(w).Encode(galleries); err != nil {
@@ -191,22 +299,339 @@ func galleriesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func galleryHandler(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) galleryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	galleryId, err := strconv.Atoi(vars["galleryId"])
 
 	if err != nil {
-		log.Fatalf("invalid gallery id")
+		http.Error(w, "Invalid gallery id", http.StatusBadRequest)
+		return
 	}
 
-	gallery, err := db.GetGallery(galleryId)
+	gallery, err := h.store.GetGallery(r.Context(), galleryId)
 
 	if err != nil {
-		log.Fatalf("error fetching gallery from vault %v", galleryId)
+		log.Printf("error fetching gallery %v: %v", galleryId, err)
+		storeError(w, r, err, "Gallery not found", http.StatusNotFound)
+		return
 	}
 
 	if err := json.NewEncoder(w).Encode(gallery); err != nil {
 		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
 	}
 }
+
+func (h *handlers) scanReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.store.GetLatestScanReport(r.Context())
+
+	if err != nil {
+		log.Printf("error fetching scan report: %v", err)
+		storeError(w, r, err, "No scan report available", http.StatusNotFound)
+		return
+	}
+
+	// Respond with the metadata as JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
+	}
+}
+
+func (h *handlers) duplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	duplicates, err := h.store.GetDuplicates(r.Context())
+
+	if err != nil {
+		log.Printf("error fetching duplicates: %v", err)
+		storeError(w, r, err, "Unable to fetch duplicates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(duplicates); err != nil {
+		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
+	}
+}
+
+func (h *handlers) subtitleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	subtitleId, err := strconv.Atoi(vars["subtitleId"])
+
+	if err != nil {
+		http.Error(w, "Invalid subtitle id", http.StatusBadRequest)
+		return
+	}
+
+	track, err := h.store.GetSubtitle(r.Context(), subtitleId)
+
+	if err != nil {
+		log.Printf("error fetching subtitle %v: %v", subtitleId, err)
+		storeError(w, r, err, "Subtitle not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := os.ReadFile(track.Path)
+
+	if err != nil {
+		log.Printf("error reading subtitle %v: %v", track.Path, err)
+		http.Error(w, "Subtitle not found", http.StatusNotFound)
+		return
+	}
+
+	vtt, err := subtitle.ToWebVTT(track.Format, data)
+
+	if err != nil {
+		log.Printf("error converting subtitle %v: %v", track.Path, err)
+		http.Error(w, "Unable to convert subtitle", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Players load tracks from another origin than the API.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+
+	w.Write(vtt)
+}
+
+func (h *handlers) galleryImagesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	galleryId, err := strconv.Atoi(vars["galleryId"])
+
+	if err != nil {
+		http.Error(w, "Invalid gallery id", http.StatusBadRequest)
+		return
+	}
+
+	page, err := queryInt(r, "page", 1)
+
+	if err != nil || page < 1 {
+		http.Error(w, "Invalid page", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultImagesLimit)
+
+	if err != nil || limit < 1 || limit > maxImagesLimit {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	query := db.ImageQuery{
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+		Sort:   r.URL.Query().Get("sort"),
+	}
+
+	if query.Sort == "" {
+		query.Sort = "name"
+	}
+
+	if query.Sort != "name" && query.Sort != "taken" {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	if query.From, err = queryTime(r, "from", false); err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+
+	if query.To, err = queryTime(r, "to", true); err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	images, total, err := h.store.GetGalleryImages(r.Context(), galleryId, query)
+
+	if err != nil {
+		log.Printf("error fetching images of gallery %v: %v", galleryId, err)
+		storeError(w, r, err, "Unable to fetch images", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	data := GalleryImagesPage{
+		Images: images,
+		Page:   page,
+		Limit:  limit,
+		Total:  total,
+	}
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, "Unable to encode metadata", http.StatusInternalServerError)
+	}
+}
+
+// queryInt reads an integer query parameter, falling back to def when it
+// is not set.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+
+	if value == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// queryTime reads an RFC 3339 time or a plain date from the query. A plain
+// date used as the end of a range includes the whole day.
+func queryTime(r *http.Request, name string, endOfDay bool) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	return &t, nil
+}
+
+// galleryPageHandler serves a single image of a gallery by its position,
+// straight out of the archive for archive galleries.
+func (h *handlers) galleryPageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	galleryId, err := strconv.Atoi(vars["galleryId"])
+
+	if err != nil {
+		http.Error(w, "Invalid gallery id", http.StatusBadRequest)
+		return
+	}
+
+	index, err := strconv.Atoi(vars["index"])
+
+	if err != nil || index < 0 {
+		http.Error(w, "Invalid page index", http.StatusBadRequest)
+		return
+	}
+
+	gallery, err := h.store.GetGallery(r.Context(), galleryId)
+
+	if err != nil {
+		log.Printf("error fetching gallery %v: %v", galleryId, err)
+		storeError(w, r, err, "Gallery not found", http.StatusNotFound)
+		return
+	}
+
+	image, err := h.store.GetGalleryImage(r.Context(), galleryId, index)
+
+	if err != nil {
+		log.Printf("error fetching page %v of gallery %v: %v", index, galleryId, err)
+		storeError(w, r, err, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if gallery.Archive {
+		serveArchiveEntry(w, gallery.Path, image.Filename)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(gallery.Path, image.Filename))
+}
+
+// thumbHandler serves a cached thumbnail of a gallery image, an actor
+// photo or a video poster in one of the thumbnail size presets.
+func (h *handlers) thumbHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kind, size := vars["kind"], vars["size"]
+
+	id, err := strconv.Atoi(vars["id"])
+
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := thumbnail.Sizes[size]; !ok {
+		http.Error(w, "Unknown thumbnail size", http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("%v-%v", kind, id)
+
+	var src thumbnail.Source
+
+	switch kind {
+	case "image":
+		var image *db.ImageFile
+
+		image, err = h.store.GetImageFile(r.Context(), id)
+
+		if err == nil && image.Archive {
+			src, err = archiveThumbSource(key, image.GalleryPath, image.Filename, image.Orientation)
+		} else if err == nil {
+			src, err = thumbnail.FileSource(key, filepath.Join(image.GalleryPath, image.Filename), image.Orientation)
+		}
+
+	case "actor", "video":
+		var path string
+
+		if kind == "actor" {
+			path, err = h.store.GetActorPhoto(r.Context(), id)
+		} else {
+			path, err = h.store.GetVideoPoster(r.Context(), id)
+		}
+
+		if err == nil && path == "" {
+			err = fmt.Errorf("%v %v has no image", kind, id)
+		}
+
+		if err == nil {
+			src, err = thumbnail.FileSource(key, path, 0)
+		}
+
+	default:
+		http.Error(w, "Unknown thumbnail kind", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("error finding source of %v thumbnail: %v", key, err)
+		storeError(w, r, err, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	thumbPath, err := thumbnail.Get(src, size)
+
+	if errors.Is(err, thumbnail.ErrUnsupported) {
+		http.Error(w, "Unsupported image format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if errors.Is(err, thumbnail.ErrTooLarge) {
+		http.Error(w, "Image too large for a thumbnail", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err != nil {
+		log.Printf("error generating %v thumbnail of %v: %v", size, key, err)
+		http.Error(w, "Unable to generate thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	http.ServeFile(w, r, thumbPath)
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reelix-go/internal/db"
+)
+
+// testLibrary is what seedStore wrote, by ID.
+type testLibrary struct {
+	vault      db.Vault
+	collection db.Collection
+	gallery    db.Gallery
+}
+
+// seedStore fills an in-memory store with a vault holding a collection
+// of two videos that share an actor, and a gallery of three images.
+func seedStore(t *testing.T) (*db.Memory, testLibrary) {
+	t.Helper()
+
+	ctx := context.Background()
+	store := db.NewMemory()
+
+	vaults, err := store.CreateVaults(ctx, []db.Vault{{Name: "home"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collections, err := store.CreateCollections(ctx, []db.Collection{{
+		Name:    "Movies",
+		Slug:    "movies",
+		VaultID: vaults[0].ID,
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.CreateVideos(ctx, []db.Video{
+		{
+			Title:        "The Film",
+			Slug:         "the_film",
+			Year:         2001,
+			CollectionID: collections[0].ID,
+			Tags:         []string{"drama", "classic"},
+			Actors:       []db.Actor{{Name: "Jane Doe", Role: "Lead"}},
+			Files:        []db.VideoFile{{Path: "/home/the_film.mkv", OSHash: "dup", Part: 1}},
+		},
+		{
+			Title:        "The Sequel",
+			Slug:         "the_sequel",
+			Year:         2005,
+			CollectionID: collections[0].ID,
+			Tags:         []string{"drama"},
+			Actors:       []db.Actor{{Name: "Jane Doe", Role: "Lead"}, {Name: "John Roe", Order: 1}},
+			Files:        []db.VideoFile{{Path: "/home/the_sequel.mkv", OSHash: "dup", Part: 1}},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	galleries, err := store.CreateGallery(ctx, []db.Gallery{{
+		Title:      "Holiday",
+		Slug:       "holiday",
+		ImageCount: 3,
+		VaultID:    vaults[0].ID,
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taken := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	err = store.CreateGalleryImages(ctx, galleries[0].ID, []db.GalleryImage{
+		{Filename: "a.jpg", SortOrder: 0, EXIF: &db.ImageEXIF{TakenAt: &taken}},
+		{Filename: "b.jpg", SortOrder: 1},
+		{Filename: "c.jpg", SortOrder: 2, EXIF: &db.ImageEXIF{TakenAt: ptr(taken.AddDate(0, 0, -1))}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, testLibrary{
+		vault:      vaults[0],
+		collection: collections[0],
+		gallery:    galleries[0],
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// get requests path from a router on store, decodes the response into
+// out when it succeeded and returns the status code.
+func get(t *testing.T, store db.Store, path string, out any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	NewRouter(store, Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if rec.Code == http.StatusOK && out != nil {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("GET %v: %v", path, err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestVideosHandler(t *testing.T) {
+	store, lib := seedStore(t)
+
+	var videos []db.Video
+
+	if code := get(t, store, fmt.Sprintf("/api/videos/%d", lib.collection.ID), &videos); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(videos) != 2 {
+		t.Fatalf("expected 2 videos, got %d", len(videos))
+	}
+
+	film := videos[0]
+
+	if film.Title != "The Film" || film.CollectionName != "Movies" || film.VaultName != "home" {
+		t.Errorf("unexpected video %+v", film)
+	}
+
+	if fmt.Sprint(film.Tags) != "[classic drama]" {
+		t.Errorf("expected sorted tags, got %v", film.Tags)
+	}
+
+	var video db.Video
+
+	if code := get(t, store, fmt.Sprintf("/api/video/%d", film.ID), &video); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(video.Actors) != 1 || video.Actors[0].Name != "Jane Doe" || video.Actors[0].Slug == "" {
+		t.Errorf("unexpected actors %+v", video.Actors)
+	}
+}
+
+func TestActorHandler(t *testing.T) {
+	store, lib := seedStore(t)
+
+	var actors struct {
+		Actors    []db.Actor `json:"actors"`
+		VaultName string     `json:"vaultName"`
+	}
+
+	if code := get(t, store, fmt.Sprintf("/api/actors/%d", lib.vault.ID), &actors); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(actors.Actors) != 2 || actors.Actors[0].Name != "Jane Doe" || actors.VaultName != "home" {
+		t.Fatalf("unexpected actors %+v", actors)
+	}
+
+	var actor ActorDetails
+
+	if code := get(t, store, fmt.Sprintf("/api/actor/%d", actors.Actors[0].ID), &actor); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// Newest first.
+	if len(actor.Videos) != 2 || actor.Videos[0].Title != "The Sequel" || actor.Videos[1].Title != "The Film" {
+		t.Errorf("unexpected videos %+v", actor.Videos)
+	}
+
+	if code := get(t, store, "/api/actor/nope", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid id, got %d", code)
+	}
+
+	if code := get(t, store, "/api/actor/9999", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing actor, got %d", code)
+	}
+}
+
+func TestGalleryImagesHandler(t *testing.T) {
+	store, lib := seedStore(t)
+
+	var page GalleryImagesPage
+
+	path := fmt.Sprintf("/api/gallery/%d/images?limit=2&page=2", lib.gallery.ID)
+
+	if code := get(t, store, path, &page); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if page.Total != 3 || len(page.Images) != 1 || page.Images[0].Filename != "c.jpg" {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	path = fmt.Sprintf("/api/gallery/%d/images?sort=taken", lib.gallery.ID)
+
+	if code := get(t, store, path, &page); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	var names []string
+
+	for _, i := range page.Images {
+		names = append(names, i.Filename)
+	}
+
+	// Images without a capture date go last.
+	if fmt.Sprint(names) != "[c.jpg a.jpg b.jpg]" {
+		t.Errorf("unexpected order %v", names)
+	}
+
+	path = fmt.Sprintf("/api/gallery/%d/images?from=2024-07-01", lib.gallery.ID)
+
+	if code := get(t, store, path, &page); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if page.Total != 1 || page.Images[0].Filename != "a.jpg" {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	path = fmt.Sprintf("/api/gallery/%d/images?sort=size", lib.gallery.ID)
+
+	if code := get(t, store, path, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown sort, got %d", code)
+	}
+}
+
+func TestScanReportHandler(t *testing.T) {
+	store := db.NewMemory()
+
+	if code := get(t, store, "/api/scan/report", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the first scan, got %d", code)
+	}
+
+	ctx := context.Background()
+	finished := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, path := range []string{"/old", "/new"} {
+		_, err := store.CreateScanReport(ctx, db.ScanReport{
+			FinishedAt: finished.Add(time.Duration(i) * time.Hour),
+			Issues:     []db.ScanIssue{{Path: path}},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var report db.ScanReport
+
+	if code := get(t, store, "/api/scan/report", &report); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(report.Issues) != 1 || report.Issues[0].Path != "/new" {
+		t.Errorf("expected the latest report, got %+v", report)
+	}
+}
+
+func TestDuplicatesHandler(t *testing.T) {
+	store, _ := seedStore(t)
+
+	var duplicates []db.DuplicateGroup
+
+	if code := get(t, store, "/api/duplicates", &duplicates); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(duplicates) != 1 || duplicates[0].OSHash != "dup" || len(duplicates[0].Videos) != 2 {
+		t.Errorf("unexpected duplicates %+v", duplicates)
+	}
+}
+
+// slowStore is a store whose vaults take longer to read than any request
+// is given, or whose queries time out by themselves when timeout is set.
+type slowStore struct {
+	db.Store
+	timeout bool
+}
+
+func (s slowStore) GetVaults(ctx context.Context) ([]db.Vault, error) {
+	if s.timeout {
+		return nil, fmt.Errorf("error fetching vaults: %w", context.DeadlineExceeded)
+	}
+
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestTimeouts(t *testing.T) {
+	rec := httptest.NewRecorder()
+	router := NewRouter(slowStore{Store: db.NewMemory()}, Options{RequestTimeout: 10 * time.Millisecond})
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/vaults", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for a request that ran out of time, got %d", rec.Code)
+	}
+
+	if code := get(t, slowStore{Store: db.NewMemory(), timeout: true}, "/api/vaults", nil); code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for a query that ran out of time, got %d", code)
+	}
+}
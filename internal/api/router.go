@@ -1,26 +1,69 @@
 package api
 
 import (
+	"context"
+	"net/http"
+	"time"
+
+	"reelix-go/internal/db"
+
 	"github.com/gorilla/mux"
 )
 
-func NewRouter() *mux.Router {
+// Options configures the router.
+type Options struct {
+	// RequestTimeout bounds how long a request may spend reading from
+	// the store. Zero leaves requests unbounded.
+	RequestTimeout time.Duration
+}
+
+// NewRouter routes the API to handlers that read from store.
+func NewRouter(store db.Store, opts Options) *mux.Router {
+	h := &handlers{store: store}
 	r := mux.NewRouter()
 
+	if opts.RequestTimeout > 0 {
+		r.Use(withTimeout(opts.RequestTimeout))
+	}
+
 	r.HandleFunc("/api/status", statusHandler).Methods("GET")
 
-	r.HandleFunc("/api/vaults", vaultsHandler).Methods("GET")
-	r.HandleFunc("/api/vault/{vaultId}", vaultHandler).Methods("GET")
+	r.HandleFunc("/api/vaults", h.vaultsHandler).Methods("GET")
+	r.HandleFunc("/api/vault/{vaultId}", h.vaultHandler).Methods("GET")
+
+	r.HandleFunc("/api/collections/{vaultId}", h.collectionsHandler).Methods("GET")
 
-	r.HandleFunc("/api/collections/{vaultId}", collectionsHandler).Methods("GET")
+	r.HandleFunc("/api/videos/{collectionId}", h.videosHandler).Methods("GET")
+	r.HandleFunc("/api/video/{videoId}", h.videoHandler).Methods("GET")
 
-	r.HandleFunc("/api/videos/{collectionId}", videosHandler).Methods("GET")
-	r.HandleFunc("/api/video/{videoId}", videoHandler).Methods("GET")
+	r.HandleFunc("/api/subtitle/{subtitleId}", h.subtitleHandler).Methods("GET")
 
-	r.HandleFunc("/api/galleries/{vaultId}", galleriesHandler).Methods("GET")
-	r.HandleFunc("/api/gallery/{galleryId}", galleryHandler).Methods("GET")
+	r.HandleFunc("/api/galleries/{vaultId}", h.galleriesHandler).Methods("GET")
+	r.HandleFunc("/api/gallery/{galleryId}", h.galleryHandler).Methods("GET")
+	r.HandleFunc("/api/gallery/{galleryId}/images", h.galleryImagesHandler).Methods("GET")
+	r.HandleFunc("/api/gallery/{galleryId}/page/{index}", h.galleryPageHandler).Methods("GET")
 
-	r.HandleFunc("/api/actors/{vaultId}", actorsHandler).Methods("GET")
+	r.HandleFunc("/api/actors/{vaultId}", h.actorsHandler).Methods("GET")
+	r.HandleFunc("/api/actor/{actorId}", h.actorHandler).Methods("GET")
+
+	r.HandleFunc("/api/thumb/{kind}/{id}/{size}", h.thumbHandler).Methods("GET")
+
+	r.HandleFunc("/api/scan/report", h.scanReportHandler).Methods("GET")
+
+	r.HandleFunc("/api/duplicates", h.duplicatesHandler).Methods("GET")
 
 	return r
 }
+
+// withTimeout cancels the context of every request after timeout, which
+// ends the store calls it is still waiting on.
+func withTimeout(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
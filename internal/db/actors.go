@@ -12,61 +12,130 @@ type Actor struct {
 	ID   int    `json:"id"`
 	Name string `xml:"name" json:"name"`
 	Slug string `json:"slug"`
+
+	// Role, Order and Thumb describe the actor's part in a
+	// single video and are only set when listed with one.
+	Role  string `xml:"role" json:"role,omitempty"`
+	Order int    `xml:"order" json:"order,omitempty"`
+	Thumb string `xml:"thumb" json:"thumb,omitempty"`
+
+	// The rest comes from the actor's own .nfo and photo.
+	Biography  string     `xml:"-" json:"biography,omitempty"`
+	Birthdate  string     `xml:"-" json:"birthdate,omitempty"`
+	Birthplace string     `xml:"-" json:"birthplace,omitempty"`
+	Aliases    []string   `xml:"-" json:"aliases,omitempty"`
+	UniqueIDs  []UniqueID `xml:"-" json:"uniqueIds,omitempty"`
+	HasPhoto   bool       `xml:"-" json:"hasPhoto,omitempty"`
+
+	// PhotoPath is the absolute path of the actor's photo in a vault.
+	PhotoPath string `xml:"-" json:"-"`
+}
+
+// ActorVideo is a video an actor appears in.
+type ActorVideo struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Slug         string `json:"slug"`
+	Year         int    `json:"year"`
+	Role         string `json:"role"`
+	CollectionID int    `json:"collectionId"`
 }
 
-func CreateActor(actor Actor) (*int, error) {
+func CreateActor(ctx context.Context, actor Actor, tx pgx.Tx) (*int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		INSERT INTO actors (name, slug) VALUES ($1, $2)
-		ON CONFLICT (name, slug) DO UPDATE SET 
+		INSERT INTO actors (
+			name, slug, photo_path,
+			biography, birthdate, birthplace, aliases
+		)
+		VALUES (
+			$1, $2, $3,
+			$4, NULLIF($5::text, '')::date, $6, $7
+		)
+		ON CONFLICT (slug) DO UPDATE SET
 			name = EXCLUDED.name,
-			slug = EXCLUDED.slug
+			photo_path = EXCLUDED.photo_path,
+			biography = EXCLUDED.biography,
+			birthdate = EXCLUDED.birthdate,
+			birthplace = EXCLUDED.birthplace,
+			aliases = EXCLUDED.aliases
 		RETURNING id
 	`
 
 	var actorId int
 
-	err := db.QueryRow(
-		context.Background(),
+	err := tx.QueryRow(
+		ctx,
 		query,
 		actor.Name,
 		actor.Slug,
+		nullIfEmpty(actor.PhotoPath),
+		actor.Biography,
+		actor.Birthdate,
+		actor.Birthplace,
+		nonNil(actor.Aliases),
 	).Scan(&actorId)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert actor %s: %w", actor.Name, err)
 	}
 
+	if err := replaceActorUniqueIDs(ctx, actorId, actor.UniqueIDs, tx); err != nil {
+		return nil, err
+	}
+
 	log.Printf("actor added: %v", actor.Name)
 
 	return &actorId, nil
 }
 
-func LinkVideoActor(videoId int, actorId int, tx pgx.Tx) error {
-	query := `
-		INSERT INTO video_actors (video_id, actor_id) VALUES ($1, $2)
-		ON CONFLICT DO NOTHING
-	`
-
+func replaceActorUniqueIDs(ctx context.Context, actorId int, ids []UniqueID, tx pgx.Tx) error {
 	_, err := tx.Exec(
-		context.Background(),
-		query,
-		videoId,
+		ctx,
+		`DELETE FROM actor_unique_ids WHERE actor_id = $1`,
 		actorId,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to get actor %v to video: %w", actorId, err)
+		return fmt.Errorf("failed to clear unique ids of actor %v: %w", actorId, err)
+	}
+
+	for _, id := range ids {
+		query := `
+			INSERT INTO actor_unique_ids (actor_id, type, value, is_default)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+		`
+
+		_, err := tx.Exec(
+			ctx,
+			query,
+			actorId,
+			id.Type,
+			id.Value,
+			id.Default,
+		)
+
+		if err != nil {
+			return fmt.Errorf("failed to add unique id %v to actor %v: %w", id.Type, actorId, err)
+		}
 	}
 
 	return nil
 }
 
-func GetActors(vaultId int) ([]Actor, error) {
+func GetActors(ctx context.Context, vaultId int, conn Querier) ([]Actor, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT
 			a.id,
 			a.name,
-			a.slug
+			a.slug,
+			a.photo_path IS NOT NULL
 		FROM actors a
 		WHERE EXISTS (
 			SELECT 1
@@ -79,15 +148,14 @@ func GetActors(vaultId int) ([]Actor, error) {
 		ORDER BY a.name
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := conn.Query(
+		ctx,
 		query,
 		vaultId,
 	)
 
 	if err != nil {
-		log.Fatal("actors query failed")
-		return nil, err
+		return nil, fmt.Errorf("failed to query actors of vault %v: %w", vaultId, err)
 	}
 	defer rows.Close()
 
@@ -95,44 +163,165 @@ func GetActors(vaultId int) ([]Actor, error) {
 
 	for rows.Next() {
 		var a Actor
-		if err := rows.Scan(&a.ID, &a.Name, &a.Slug); err != nil {
-			log.Fatal("actors scan failed")
-			return nil, err
+		if err := rows.Scan(&a.ID, &a.Name, &a.Slug, &a.HasPhoto); err != nil {
+			return nil, fmt.Errorf("failed to scan actor of vault %v: %w", vaultId, err)
 		}
 
 		actors = append(actors, a)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal("actors rows failed")
-		return nil, err
+		return nil, fmt.Errorf("failed to read actors of vault %v: %w", vaultId, err)
 	}
 
 	return actors, nil
 }
 
-func GetActor(name string) (*int, error) {
+// DeleteOrphanActors removes actors that are neither linked to a video nor
+// have a photo (identified by keepSlugs) in any vault, and returns their names.
+func DeleteOrphanActors(ctx context.Context, keepSlugs []string, tx pgx.Tx) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT 
-			id
+		DELETE FROM actors a
+		WHERE NOT EXISTS (
+			SELECT 1 FROM video_actors va WHERE va.actor_id = a.id
+		)
+		AND NOT (a.slug = ANY($1::text[]))
+		RETURNING name
+	`
+
+	rows, err := tx.Query(
+		ctx,
+		query,
+		nonNil(keepSlugs),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete orphan actors: %w", err)
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// GetActorPhoto returns the path of an actor's photo, or an empty string
+// when the actor has none.
+func GetActorPhoto(ctx context.Context, actorId int, conn Querier) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			COALESCE(photo_path, '')
 		FROM
 			actors
-		WHERE	
-			name = $1
-		LIMIT 1
+		WHERE
+			id = $1
+	`
+
+	var path string
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+		actorId,
+	).Scan(&path)
+
+	if err != nil {
+		return "", fmt.Errorf("error fetching actor photo: %w", err)
+	}
+
+	return path, nil
+}
+
+// GetActorByID returns an actor with everything we know about them.
+func GetActorByID(ctx context.Context, actorId int, conn Querier) (*Actor, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			a.id,
+			a.name,
+			a.slug,
+			a.biography,
+			COALESCE(to_char(a.birthdate, 'YYYY-MM-DD'), ''),
+			a.birthplace,
+			a.aliases,
+			a.photo_path IS NOT NULL,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'type', u.type,
+					'value', u.value,
+					'default', u.is_default
+				) ORDER BY u.is_default DESC, u.type)
+				FROM actor_unique_ids u
+				WHERE u.actor_id = a.id
+			), '[]')
+		FROM
+			actors a
+		WHERE
+			a.id = $1
 	`
 
 	var a Actor
 
-	err := db.QueryRow(
-		context.Background(),
+	err := conn.QueryRow(
+		ctx,
+		query,
+		actorId,
+	).Scan(
+		&a.ID,
+		&a.Name,
+		&a.Slug,
+		&a.Biography,
+		&a.Birthdate,
+		&a.Birthplace,
+		&a.Aliases,
+		&a.HasPhoto,
+		&a.UniqueIDs,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching actor %v: %w", actorId, err)
+	}
+
+	return &a, nil
+}
+
+// GetActorVideos lists the videos an actor appears in, newest first.
+func GetActorVideos(ctx context.Context, actorId int, conn Querier) ([]ActorVideo, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			v.id,
+			v.title,
+			v.slug,
+			COALESCE(v.year, 0),
+			va.role,
+			v.collection_id
+		FROM
+			video_actors va
+		JOIN
+			videos v ON v.id = va.video_id
+		WHERE
+			va.actor_id = $1
+		ORDER BY
+			v.year DESC NULLS LAST, v.title
+	`
+
+	rows, err := conn.Query(
+		ctx,
 		query,
-		name,
-	).Scan(&a.ID)
+		actorId,
+	)
 
 	if err != nil {
-		return nil, fmt.Errorf("error fetching actor: %v", err)
+		return nil, fmt.Errorf("error fetching videos of actor %v: %w", actorId, err)
 	}
 
-	return &a.ID, nil
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[ActorVideo])
 }
@@ -2,7 +2,10 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"log"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type Collection struct {
@@ -12,9 +15,16 @@ type Collection struct {
 	Path      string `json:"path"`
 	VaultID   int    `json:"vaultId"`
 	VaultName string `json:"vaultName"`
+
+	// ScanState is saved along with the collection, so it isn't read
+	// again until something in it changes.
+	ScanState *ScanState `json:"-"`
 }
 
-func CreateCollections(collections []Collection) ([]Collection, error) {
+func CreateCollections(ctx context.Context, collections []Collection, tx pgx.Tx) ([]Collection, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	// We use make() here because at this point we know the size of
 	// the slices and we won't need to reallocate memory if we were
 	// to just loop and append.
@@ -46,8 +56,8 @@ func CreateCollections(collections []Collection) ([]Collection, error) {
 		RETURNING id, name, slug, path, vault_id
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := tx.Query(
+		ctx,
 		query,
 		names,
 		slugs,
@@ -78,10 +88,40 @@ func CreateCollections(collections []Collection) ([]Collection, error) {
 		dbCollections = append(dbCollections, c)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		name    string
+		vaultId int
+	}
+
+	states := make(map[key]*ScanState, len(collections))
+
+	for _, c := range collections {
+		states[key{c.Name, c.VaultID}] = c.ScanState
+	}
+
+	ids := make([]int, len(dbCollections))
+	collectionStates := make([]*ScanState, len(dbCollections))
+
+	for i, c := range dbCollections {
+		ids[i] = c.ID
+		collectionStates[i] = states[key{c.Name, c.VaultID}]
+	}
+
+	if err := saveScanStates(ctx, "collection_id", ids, collectionStates, tx); err != nil {
+		return nil, err
+	}
+
 	return dbCollections, nil
 }
 
-func GetCollections(vaultId int) ([]Collection, error) {
+func GetCollections(ctx context.Context, vaultId int, conn Querier) ([]Collection, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT 
 			c.id, 
@@ -93,17 +133,18 @@ func GetCollections(vaultId int) ([]Collection, error) {
 			vaults v ON c.vault_id = v.id
 		WHERE 
 			c.vault_id = $1
+		ORDER BY
+			c.id
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := conn.Query(
+		ctx,
 		query,
 		vaultId,
 	)
 
 	if err != nil {
-		log.Fatal("collection query failed")
-		return nil, err
+		return nil, fmt.Errorf("failed to query collections of vault %v: %w", vaultId, err)
 	}
 	defer rows.Close()
 
@@ -126,3 +167,30 @@ func GetCollections(vaultId int) ([]Collection, error) {
 
 	return collections, nil
 }
+
+// DeleteCollectionsExcept removes the collections of a vault that are not
+// named in names and returns the names of the removed collections.
+func DeleteCollectionsExcept(ctx context.Context, vaultId int, names []string, tx pgx.Tx) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM collections
+		WHERE vault_id = $1
+		AND NOT (name = ANY($2::text[]))
+		RETURNING name
+	`
+
+	rows, err := tx.Query(
+		ctx,
+		query,
+		vaultId,
+		nonNil(names),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete collections from vault %v: %w", vaultId, err)
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// DuplicateGroup is a set of video files and gallery images that share
+// the same content fingerprint, wherever in the library they are.
+type DuplicateGroup struct {
+	OSHash string           `json:"oshash"`
+	Videos []DuplicateVideo `json:"videos"`
+	Images []DuplicateImage `json:"images"`
+}
+
+type DuplicateVideo struct {
+	VideoID        int    `json:"videoId"`
+	Title          string `json:"title"`
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`
+	SHA256         string `json:"sha256,omitempty"`
+	CollectionID   int    `json:"collectionId"`
+	CollectionName string `json:"collectionName"`
+	VaultID        int    `json:"vaultId"`
+	VaultName      string `json:"vaultName"`
+}
+
+type DuplicateImage struct {
+	ImageID      int    `json:"imageId"`
+	Filename     string `json:"filename"`
+	SHA256       string `json:"sha256,omitempty"`
+	GalleryID    int    `json:"galleryId"`
+	GalleryTitle string `json:"galleryTitle"`
+	VaultID      int    `json:"vaultId"`
+	VaultName    string `json:"vaultName"`
+}
+
+// GetDuplicates returns every oshash that is shared by more than one video
+// or gallery image. Two parts of the same video sharing a hash don't count.
+func GetDuplicates(ctx context.Context, conn Querier) ([]DuplicateGroup, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH entries AS (
+			SELECT oshash, 'video:' || video_id AS owner
+			FROM video_files
+			WHERE oshash IS NOT NULL
+			UNION ALL
+			SELECT oshash, 'image:' || id AS owner
+			FROM gallery_images
+			WHERE oshash IS NOT NULL
+		),
+		duplicates AS (
+			SELECT oshash
+			FROM entries
+			GROUP BY oshash
+			HAVING COUNT(DISTINCT owner) > 1
+		)
+		SELECT
+			d.oshash,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'videoId', v.id,
+					'title', v.title,
+					'path', f.path,
+					'size', f.size,
+					'sha256', f.sha256,
+					'collectionId', c.id,
+					'collectionName', c.name,
+					'vaultId', va.id,
+					'vaultName', va.name
+				) ORDER BY va.name, c.name, f.path)
+				FROM video_files f
+				JOIN videos v ON f.video_id = v.id
+				JOIN collections c ON v.collection_id = c.id
+				JOIN vaults va ON c.vault_id = va.id
+				WHERE f.oshash = d.oshash
+			), '[]'),
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'imageId', i.id,
+					'filename', i.filename,
+					'sha256', i.sha256,
+					'galleryId', g.id,
+					'galleryTitle', g.title,
+					'vaultId', va.id,
+					'vaultName', va.name
+				) ORDER BY va.name, g.slug, i.filename)
+				FROM gallery_images i
+				JOIN galleries g ON i.gallery_id = g.id
+				JOIN vaults va ON g.vault_id = va.id
+				WHERE i.oshash = d.oshash
+			), '[]')
+		FROM
+			duplicates d
+		ORDER BY
+			d.oshash
+	`
+
+	rows, err := conn.Query(ctx, query)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query duplicates: %w", err)
+	}
+
+	defer rows.Close()
+
+	groups := []DuplicateGroup{}
+
+	for rows.Next() {
+		var g DuplicateGroup
+
+		if err := rows.Scan(&g.OSHash, &g.Videos, &g.Images); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicates: %w", err)
+		}
+
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read duplicates: %w", err)
+	}
+
+	return groups, nil
+}
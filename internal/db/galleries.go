@@ -3,60 +3,161 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// Gallery is a folder or archive of images. Galleries nest like the
+// folders they come from, and their slug is their path below pictures/.
 type Gallery struct {
 	ID         int    `json:"id"`
 	Title      string `json:"title"`
 	Slug       string `json:"slug"`
+	ParentID   *int   `json:"parentId"`
 	ImageCount int    `json:"imageCount"`
+	Archive    bool   `json:"archive"`
 	VaultID    int    `json:"vaultId"`
 	VaultName  string `json:"vaultName"`
+
+	// TotalImageCount also counts the images of nested galleries.
+	TotalImageCount int `json:"totalImageCount"`
+
+	// ParentSlug links a scanned gallery to its parent until both
+	// have an ID.
+	ParentSlug string `json:"-"`
+
+	Children    []Gallery    `json:"children,omitempty"`
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs,omitempty"`
+
+	// Path is the absolute path of the gallery folder or archive and
+	// is only used to serve its images.
+	Path string `json:"-"`
+
+	// TakenFrom and TakenTo span the capture dates of the images.
+	TakenFrom *time.Time `json:"takenFrom,omitempty"`
+	TakenTo   *time.Time `json:"takenTo,omitempty"`
+
+	Images []GalleryImage `json:"images,omitempty"`
+
+	// ScanState is saved along with a top level gallery, so neither it
+	// nor the galleries nested in it are read again until they change.
+	ScanState *ScanState `json:"-"`
+}
+
+// Breadcrumb is one of the galleries on the way from the top of a vault's
+// pictures down to a gallery.
+type Breadcrumb struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+// GalleryImage is an image file inside a gallery folder.
+type GalleryImage struct {
+	ID        int    `json:"id"`
+	Filename  string `json:"filename"`
+	SortOrder int    `json:"sortOrder"`
+	Size      int64  `json:"size"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Format    string `json:"format"`
+	OSHash    string `json:"oshash"`
+	SHA256    string `json:"sha256,omitempty"`
+
+	EXIF *ImageEXIF `json:"exif,omitempty"`
 }
 
-func CreateGallery(galleries []Gallery) ([]Gallery, error) {
+// ImageEXIF is the camera metadata embedded in an image.
+type ImageEXIF struct {
+	TakenAt      *time.Time `json:"takenAt,omitempty"`
+	Make         string     `json:"make,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	Lens         string     `json:"lens,omitempty"`
+	Orientation  int        `json:"orientation,omitempty"`
+	ExposureTime string     `json:"exposureTime,omitempty"`
+	FNumber      float64    `json:"fNumber,omitempty"`
+	ISO          int        `json:"iso,omitempty"`
+	FocalLength  float64    `json:"focalLength,omitempty"`
+	Latitude     *float64   `json:"latitude,omitempty"`
+	Longitude    *float64   `json:"longitude,omitempty"`
+	Altitude     *float64   `json:"altitude,omitempty"`
+}
+
+// ImageQuery selects a page of the images of a gallery.
+type ImageQuery struct {
+	Limit  int
+	Offset int
+
+	// Sort is "name" for the natural order of the file names or
+	// "taken" for the capture date, oldest first.
+	Sort string
+
+	// From and To only keep images taken within the range.
+	From *time.Time
+	To   *time.Time
+}
+
+func CreateGallery(ctx context.Context, galleries []Gallery, tx pgx.Tx) ([]Gallery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	// We use make() here because at this point we know the size of
 	// the slices and we won't need to reallocate memory if we were
 	// to just loop and append.
 
 	titles := make([]string, len(galleries))
 	slugs := make([]string, len(galleries))
+	parentSlugs := make([]string, len(galleries))
 	imageCounts := make([]int, len(galleries))
+	totalImageCounts := make([]int, len(galleries))
 	vaultIds := make([]int, len(galleries))
+	paths := make([]string, len(galleries))
+	archives := make([]bool, len(galleries))
 
 	for i, g := range galleries {
 		titles[i] = g.Title
 		slugs[i] = g.Slug
+		parentSlugs[i] = g.ParentSlug
 		imageCounts[i] = g.ImageCount
+		totalImageCounts[i] = g.TotalImageCount
 		vaultIds[i] = g.VaultID
+		paths[i] = g.Path
+		archives[i] = g.Archive
 	}
 
 	query := `
-		INSERT INTO galleries (title, slug, image_count, vault_id)
+		INSERT INTO galleries (title, slug, image_count, total_image_count, vault_id, path, archive)
 		SELECT *
 		FROM UNNEST(
 			$1::text[],
 			$2::text[],
 			$3::int[],
-			$4::int[]
+			$4::int[],
+			$5::int[],
+			$6::text[],
+			$7::bool[]
 		)
-		ON CONFLICT (title, slug) 
+		ON CONFLICT (vault_id, slug) 
 		DO UPDATE SET
 			title = EXCLUDED.title,
-			slug = EXCLUDED.slug,
 			image_count = EXCLUDED.image_count,
-			vault_id = EXCLUDED.vault_id
-		RETURNING id, title, slug, image_count, vault_id
+			total_image_count = EXCLUDED.total_image_count,
+			path = EXCLUDED.path,
+			archive = EXCLUDED.archive
+		RETURNING id, title, slug, image_count, total_image_count, vault_id
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := tx.Query(
+		ctx,
 		query,
 		titles,
 		slugs,
 		imageCounts,
+		totalImageCounts,
 		vaultIds,
+		paths,
+		archives,
 	)
 
 	if err != nil {
@@ -75,94 +176,690 @@ func CreateGallery(galleries []Gallery) ([]Gallery, error) {
 	for rows.Next() {
 		var g Gallery
 
-		if err := rows.Scan(&g.ID, &g.Title, &g.Slug, &g.ImageCount, &g.VaultID); err != nil {
+		if err := rows.Scan(&g.ID, &g.Title, &g.Slug, &g.ImageCount, &g.TotalImageCount, &g.VaultID); err != nil {
 			return nil, err
 		}
 
 		dbGalleries = append(dbGalleries, g)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Now that every gallery has an ID the nested ones can point
+	// to their parent. Top level galleries have no parent slug and
+	// end up without a parent.
+
+	linkQuery := `
+		UPDATE galleries c
+		SET parent_id = p.id
+		FROM UNNEST(
+			$1::text[],
+			$2::text[],
+			$3::int[]
+		) AS t(slug, parent_slug, vault_id)
+		LEFT JOIN galleries p ON p.vault_id = t.vault_id AND p.slug = t.parent_slug
+		WHERE c.vault_id = t.vault_id
+		AND c.slug = t.slug
+		AND c.parent_id IS DISTINCT FROM p.id
+	`
+
+	_, err = tx.Exec(
+		ctx,
+		linkQuery,
+		slugs,
+		parentSlugs,
+		vaultIds,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to link nested galleries: %w", err)
+	}
+
+	type key struct {
+		slug    string
+		vaultId int
+	}
+
+	states := make(map[key]*ScanState, len(galleries))
+
+	for _, g := range galleries {
+		states[key{g.Slug, g.VaultID}] = g.ScanState
+	}
+
+	ids := make([]int, len(dbGalleries))
+	galleryStates := make([]*ScanState, len(dbGalleries))
+
+	for i, g := range dbGalleries {
+		ids[i] = g.ID
+		galleryStates[i] = states[key{g.Slug, g.VaultID}]
+	}
+
+	if err := saveScanStates(ctx, "gallery_id", ids, galleryStates, tx); err != nil {
+		return nil, err
+	}
+
 	return dbGalleries, nil
 }
 
-func GetGalleries(vaultId int) ([]Gallery, error) {
-	query := `
-		SELECT 
-			g.id,
-			g.title,
-			g.slug,
-			g.image_count,
-			v.id AS vault_id,
-			v.name AS vault_name
-		FROM
-			galleries g
-		JOIN 
-			vaults v ON g.vault_id = v.id
+// gallerySelect selects a gallery with the capture dates of its images,
+// including those of nested galleries, and its direct children.
+const gallerySelect = `
+	SELECT 
+		g.id,
+		g.title,
+		g.slug,
+		g.parent_id,
+		g.image_count,
+		g.total_image_count,
+		g.archive,
+		g.path,
+		v.id AS vault_id,
+		v.name AS vault_name,
+		taken.taken_from,
+		taken.taken_to,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'id', c.id,
+				'title', c.title,
+				'slug', c.slug,
+				'parentId', c.parent_id,
+				'imageCount', c.image_count,
+				'totalImageCount', c.total_image_count,
+				'archive', c.archive,
+				'vaultId', v.id,
+				'vaultName', v.name
+			) ORDER BY c.slug)
+			FROM galleries c
+			WHERE c.parent_id = g.id
+		), '[]') AS children
+	FROM
+		galleries g
+	JOIN 
+		vaults v ON g.vault_id = v.id
+	LEFT JOIN LATERAL (
+		SELECT
+			MIN(i.taken_at) AS taken_from,
+			MAX(i.taken_at) AS taken_to
+		FROM gallery_images i
+		JOIN galleries d ON d.id = i.gallery_id
+		WHERE d.vault_id = g.vault_id
+		AND (d.id = g.id OR starts_with(d.slug, g.slug || '/'))
+	) taken ON TRUE
+`
+
+func scanGallery(row pgx.Row) (Gallery, error) {
+	var g Gallery
+
+	err := row.Scan(
+		&g.ID,
+		&g.Title,
+		&g.Slug,
+		&g.ParentID,
+		&g.ImageCount,
+		&g.TotalImageCount,
+		&g.Archive,
+		&g.Path,
+		&g.VaultID,
+		&g.VaultName,
+		&g.TakenFrom,
+		&g.TakenTo,
+		&g.Children,
+	)
+
+	return g, err
+}
+
+// GetGalleries returns the top level galleries of a vault. Nested
+// galleries are listed as the children of their parent.
+func GetGalleries(ctx context.Context, vaultId int, conn Querier) ([]Gallery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := gallerySelect + `
 		WHERE	
 			g.vault_id = $1
+			AND g.parent_id IS NULL
+		ORDER BY
+			g.slug
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := conn.Query(
+		ctx,
 		query,
 		vaultId,
 	)
 
 	if err != nil {
-		log.Fatal("galleries query failed")
-		return nil, err
+		return nil, fmt.Errorf("failed to query galleries of vault %v: %w", vaultId, err)
 	}
 	defer rows.Close()
 
 	var galleries []Gallery
 
 	for rows.Next() {
-		var g Gallery
+		g, err := scanGallery(rows)
 
-		if err := rows.Scan(&g.ID, &g.Title, &g.Slug, &g.ImageCount, &g.VaultID, &g.VaultName); err != nil {
-			log.Fatal("galleries scan failed")
-			return nil, err
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan gallery of vault %v: %w", vaultId, err)
 		}
 
 		galleries = append(galleries, g)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal("galleries rows failed")
-		return nil, err
+		return nil, fmt.Errorf("failed to read galleries of vault %v: %w", vaultId, err)
 	}
 
 	return galleries, nil
 }
 
-func GetGallery(galleryId int) (*Gallery, error) {
-	query := `
-		SELECT 
-			g.id,
-			g.title,
-			g.slug,
-			g.image_count,
-			v.id AS vault_id,
-			v.name AS vault_name
-		FROM
-			galleries g
-		JOIN 
-			vaults v ON g.vault_id = v.id
+func GetGallery(ctx context.Context, galleryId int, conn Querier) (*Gallery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := gallerySelect + `
 		WHERE	
 			g.id = $1
 	`
 
-	var g Gallery
-
-	err := db.QueryRow(
-		context.Background(),
+	g, err := scanGallery(conn.QueryRow(
+		ctx,
 		query,
 		galleryId,
-	).Scan(&g.ID, &g.Title, &g.Slug, &g.ImageCount, &g.VaultID, &g.VaultName)
+	))
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching gallery: %w", err)
+	}
+
+	g.Breadcrumbs, err = getBreadcrumbs(ctx, galleryId, conn)
 
 	if err != nil {
-		return nil, fmt.Errorf("error fetching gallery: %v", err)
+		return nil, err
 	}
 
 	return &g, nil
 }
+
+// getBreadcrumbs walks up from a gallery to the top of its vault and
+// returns the way back down, ending with the gallery itself.
+func getBreadcrumbs(ctx context.Context, galleryId int, conn Querier) ([]Breadcrumb, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, title, slug, parent_id, 0 AS depth
+			FROM galleries
+			WHERE id = $1
+			UNION ALL
+			SELECT g.id, g.title, g.slug, g.parent_id, a.depth + 1
+			FROM galleries g
+			JOIN ancestors a ON g.id = a.parent_id
+		)
+		SELECT id, title, slug
+		FROM ancestors
+		ORDER BY depth DESC
+	`
+
+	rows, err := conn.Query(
+		ctx,
+		query,
+		galleryId,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching breadcrumbs of gallery %v: %w", galleryId, err)
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[Breadcrumb])
+}
+
+// DeleteGalleriesExcept removes the galleries of a vault whose slug is not
+// in slugs and returns the titles of the removed galleries. The skipped
+// galleries are kept along with everything nested in them.
+func DeleteGalleriesExcept(ctx context.Context, vaultId int, slugs []string, skipped []string, tx pgx.Tx) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM galleries g
+		WHERE g.vault_id = $1
+		AND NOT (g.slug = ANY($2::text[]))
+		AND NOT EXISTS (
+			SELECT 1
+			FROM UNNEST($3::text[]) AS s(slug)
+			WHERE g.slug = s.slug OR starts_with(g.slug, s.slug || '/')
+		)
+		RETURNING g.title
+	`
+
+	rows, err := tx.Query(
+		ctx,
+		query,
+		vaultId,
+		nonNil(slugs),
+		nonNil(skipped),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete galleries from vault %v: %w", vaultId, err)
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// CreateGalleryImages replaces the images of a gallery. Images keep their
+// ID for as long as their filename stays the same.
+func CreateGalleryImages(ctx context.Context, galleryId int, images []GalleryImage, tx pgx.Tx) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filenames := make([]string, len(images))
+	sortOrders := make([]int, len(images))
+	sizes := make([]int64, len(images))
+	widths := make([]int, len(images))
+	heights := make([]int, len(images))
+	formats := make([]string, len(images))
+	oshashes := make([]string, len(images))
+	sha256s := make([]string, len(images))
+	takenAts := make([]*time.Time, len(images))
+	makes := make([]string, len(images))
+	models := make([]string, len(images))
+	lenses := make([]string, len(images))
+	orientations := make([]int, len(images))
+	exposureTimes := make([]string, len(images))
+	fNumbers := make([]float64, len(images))
+	isos := make([]int, len(images))
+	focalLengths := make([]float64, len(images))
+	latitudes := make([]*float64, len(images))
+	longitudes := make([]*float64, len(images))
+	altitudes := make([]*float64, len(images))
+
+	for i, image := range images {
+		filenames[i] = image.Filename
+		sortOrders[i] = image.SortOrder
+		sizes[i] = image.Size
+		widths[i] = image.Width
+		heights[i] = image.Height
+		formats[i] = image.Format
+		oshashes[i] = image.OSHash
+		sha256s[i] = image.SHA256
+
+		if exif := image.EXIF; exif != nil {
+			takenAts[i] = exif.TakenAt
+			makes[i] = exif.Make
+			models[i] = exif.Model
+			lenses[i] = exif.Lens
+			orientations[i] = exif.Orientation
+			exposureTimes[i] = exif.ExposureTime
+			fNumbers[i] = exif.FNumber
+			isos[i] = exif.ISO
+			focalLengths[i] = exif.FocalLength
+			latitudes[i] = exif.Latitude
+			longitudes[i] = exif.Longitude
+			altitudes[i] = exif.Altitude
+		}
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		`DELETE FROM gallery_images WHERE gallery_id = $1 AND NOT (filename = ANY($2::text[]))`,
+		galleryId,
+		filenames,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to clear images of gallery %v: %w", galleryId, err)
+	}
+
+	query := `
+		INSERT INTO gallery_images (
+			gallery_id,
+			filename,
+			sort_order,
+			size,
+			width,
+			height,
+			format,
+			oshash,
+			sha256,
+			taken_at,
+			camera_make,
+			camera_model,
+			lens,
+			orientation,
+			exposure_time,
+			f_number,
+			iso,
+			focal_length,
+			latitude,
+			longitude,
+			altitude
+		)
+		SELECT
+			$1,
+			t.filename,
+			t.sort_order,
+			t.size,
+			NULLIF(t.width, 0),
+			NULLIF(t.height, 0),
+			t.format,
+			NULLIF(t.oshash, ''),
+			NULLIF(t.sha256, ''),
+			t.taken_at,
+			NULLIF(t.camera_make, ''),
+			NULLIF(t.camera_model, ''),
+			NULLIF(t.lens, ''),
+			NULLIF(t.orientation, 0),
+			NULLIF(t.exposure_time, ''),
+			NULLIF(t.f_number, 0),
+			NULLIF(t.iso, 0),
+			NULLIF(t.focal_length, 0),
+			t.latitude,
+			t.longitude,
+			t.altitude
+		FROM UNNEST(
+			$2::text[],
+			$3::int[],
+			$4::bigint[],
+			$5::int[],
+			$6::int[],
+			$7::text[],
+			$8::text[],
+			$9::text[],
+			$10::timestamptz[],
+			$11::text[],
+			$12::text[],
+			$13::text[],
+			$14::int[],
+			$15::text[],
+			$16::float8[],
+			$17::int[],
+			$18::float8[],
+			$19::float8[],
+			$20::float8[],
+			$21::float8[]
+		) AS t(
+			filename,
+			sort_order,
+			size,
+			width,
+			height,
+			format,
+			oshash,
+			sha256,
+			taken_at,
+			camera_make,
+			camera_model,
+			lens,
+			orientation,
+			exposure_time,
+			f_number,
+			iso,
+			focal_length,
+			latitude,
+			longitude,
+			altitude
+		)
+		ON CONFLICT (gallery_id, filename)
+		DO UPDATE SET
+			sort_order = EXCLUDED.sort_order,
+			size = EXCLUDED.size,
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			format = EXCLUDED.format,
+			oshash = EXCLUDED.oshash,
+			sha256 = EXCLUDED.sha256,
+			taken_at = EXCLUDED.taken_at,
+			camera_make = EXCLUDED.camera_make,
+			camera_model = EXCLUDED.camera_model,
+			lens = EXCLUDED.lens,
+			orientation = EXCLUDED.orientation,
+			exposure_time = EXCLUDED.exposure_time,
+			f_number = EXCLUDED.f_number,
+			iso = EXCLUDED.iso,
+			focal_length = EXCLUDED.focal_length,
+			latitude = EXCLUDED.latitude,
+			longitude = EXCLUDED.longitude,
+			altitude = EXCLUDED.altitude
+	`
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		galleryId,
+		filenames,
+		sortOrders,
+		sizes,
+		widths,
+		heights,
+		formats,
+		oshashes,
+		sha256s,
+		takenAts,
+		makes,
+		models,
+		lenses,
+		orientations,
+		exposureTimes,
+		fNumbers,
+		isos,
+		focalLengths,
+		latitudes,
+		longitudes,
+		altitudes,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to add images to gallery %v: %w", galleryId, err)
+	}
+
+	return nil
+}
+
+// GetGalleryImages returns a page of the images of a gallery, along with
+// the number of images that match the query in total.
+func GetGalleryImages(ctx context.Context, galleryId int, q ImageQuery, conn Querier) ([]GalleryImage, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	filter := `
+		WHERE
+			gallery_id = $1
+			AND ($2::timestamptz IS NULL OR taken_at >= $2)
+			AND ($3::timestamptz IS NULL OR taken_at <= $3)
+	`
+
+	var total int
+
+	err := conn.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM gallery_images`+filter,
+		galleryId,
+		q.From,
+		q.To,
+	).Scan(&total)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count images of gallery %v: %w", galleryId, err)
+	}
+
+	// Images without a capture date go last when sorting by date.
+	order := "sort_order, filename"
+
+	if q.Sort == "taken" {
+		order = "taken_at NULLS LAST, sort_order, filename"
+	}
+
+	query := `
+		SELECT
+			id,
+			filename,
+			sort_order,
+			size,
+			COALESCE(width, 0),
+			COALESCE(height, 0),
+			format,
+			COALESCE(oshash, ''),
+			COALESCE(sha256, ''),
+			taken_at,
+			COALESCE(camera_make, ''),
+			COALESCE(camera_model, ''),
+			COALESCE(lens, ''),
+			COALESCE(orientation, 0),
+			COALESCE(exposure_time, ''),
+			COALESCE(f_number, 0),
+			COALESCE(iso, 0),
+			COALESCE(focal_length, 0),
+			latitude,
+			longitude,
+			altitude
+		FROM
+			gallery_images
+	` + filter + `
+		ORDER BY
+			` + order + `
+		LIMIT $4
+		OFFSET $5
+	`
+
+	rows, err := conn.Query(
+		ctx,
+		query,
+		galleryId,
+		q.From,
+		q.To,
+		q.Limit,
+		q.Offset,
+	)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query images of gallery %v: %w", galleryId, err)
+	}
+
+	defer rows.Close()
+
+	images := []GalleryImage{}
+
+	for rows.Next() {
+		var i GalleryImage
+		var exif ImageEXIF
+
+		err := rows.Scan(
+			&i.ID,
+			&i.Filename,
+			&i.SortOrder,
+			&i.Size,
+			&i.Width,
+			&i.Height,
+			&i.Format,
+			&i.OSHash,
+			&i.SHA256,
+			&exif.TakenAt,
+			&exif.Make,
+			&exif.Model,
+			&exif.Lens,
+			&exif.Orientation,
+			&exif.ExposureTime,
+			&exif.FNumber,
+			&exif.ISO,
+			&exif.FocalLength,
+			&exif.Latitude,
+			&exif.Longitude,
+			&exif.Altitude,
+		)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan image of gallery %v: %w", galleryId, err)
+		}
+
+		if exif != (ImageEXIF{}) {
+			i.EXIF = &exif
+		}
+
+		images = append(images, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read images of gallery %v: %w", galleryId, err)
+	}
+
+	return images, total, nil
+}
+
+// GetGalleryImage returns the image at the given position of a gallery.
+func GetGalleryImage(ctx context.Context, galleryId int, sortOrder int, conn Querier) (*GalleryImage, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			id,
+			filename,
+			sort_order,
+			size,
+			format
+		FROM
+			gallery_images
+		WHERE
+			gallery_id = $1
+			AND sort_order = $2
+	`
+
+	var i GalleryImage
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+		galleryId,
+		sortOrder,
+	).Scan(&i.ID, &i.Filename, &i.SortOrder, &i.Size, &i.Format)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching image %v of gallery %v: %w", sortOrder, galleryId, err)
+	}
+
+	return &i, nil
+}
+
+// ImageFile locates an image on disk, either as a file in the gallery
+// folder or as an entry of the gallery archive.
+type ImageFile struct {
+	Filename    string
+	Orientation int
+	GalleryPath string
+	Archive     bool
+}
+
+func GetImageFile(ctx context.Context, imageId int, conn Querier) (*ImageFile, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			i.filename,
+			COALESCE(i.orientation, 0),
+			g.path,
+			g.archive
+		FROM
+			gallery_images i
+		JOIN
+			galleries g ON g.id = i.gallery_id
+		WHERE
+			i.id = $1
+	`
+
+	var f ImageFile
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+		imageId,
+	).Scan(&f.Filename, &f.Orientation, &f.GalleryPath, &f.Archive)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching image %v: %w", imageId, err)
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,1373 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"reelix-go/internal/utils"
+)
+
+// Memory is a Store that keeps everything in memory, for tests and for
+// running without a database. It follows the Postgres store as closely as
+// tests need it to. Transactions take turns and are committed as a whole.
+type Memory struct {
+	mu   *sync.Mutex
+	data *memoryData
+
+	// inTx is set on the Store handed to InTx, which already holds
+	// the lock.
+	inTx bool
+}
+
+type memoryData struct {
+	lastID int
+
+	vaults      map[int]Vault
+	collections map[int]Collection
+	videos      map[int]Video
+	actors      map[int]Actor
+	tags        map[int]string
+	galleries   map[int]Gallery
+	images      map[int]memoryImage
+	reports     []ScanReport
+}
+
+type memoryImage struct {
+	GalleryImage
+	galleryID int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.Mutex{},
+		data: &memoryData{
+			vaults:      map[int]Vault{},
+			collections: map[int]Collection{},
+			videos:      map[int]Video{},
+			actors:      map[int]Actor{},
+			tags:        map[int]string{},
+			galleries:   map[int]Gallery{},
+			images:      map[int]memoryImage{},
+		},
+	}
+}
+
+// clone copies the tables. Rows are replaced rather than changed in place,
+// so the rows themselves can be shared.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		lastID:      d.lastID,
+		vaults:      maps.Clone(d.vaults),
+		collections: maps.Clone(d.collections),
+		videos:      maps.Clone(d.videos),
+		actors:      maps.Clone(d.actors),
+		tags:        maps.Clone(d.tags),
+		galleries:   maps.Clone(d.galleries),
+		images:      maps.Clone(d.images),
+		reports:     slices.Clone(d.reports),
+	}
+}
+
+func (d *memoryData) nextID() int {
+	d.lastID++
+	return d.lastID
+}
+
+func (m *Memory) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+
+	m.mu.Lock()
+
+	return m.mu.Unlock
+}
+
+func (m *Memory) InTx(ctx context.Context, fn func(store Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &Memory{mu: m.mu, data: m.data.clone(), inTx: true}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	// Like a commit, this fails once ctx is done.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.data = tx.data
+
+	return nil
+}
+
+// sortedRows returns the rows of a table ordered by compare.
+func sortedRows[T any](table map[int]T, compare func(a, b T) int) []T {
+	return slices.SortedFunc(maps.Values(table), compare)
+}
+
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+
+	return s
+}
+
+func (m *Memory) GetVaults(ctx context.Context) ([]Vault, error) {
+	defer m.lock()()
+
+	var vaults []Vault
+
+	for _, v := range m.sortedVaults() {
+		vaults = append(vaults, vault(v))
+	}
+
+	return vaults, nil
+}
+
+// vault leaves out what the Postgres store doesn't select.
+func vault(v Vault) Vault {
+	v.ActorsScanState = nil
+	return v
+}
+
+func (m *Memory) GetVault(ctx context.Context, vaultId int) (*Vault, error) {
+	defer m.lock()()
+
+	v, ok := m.data.vaults[vaultId]
+
+	if !ok {
+		return nil, fmt.Errorf("error fetching vault %v: not found", vaultId)
+	}
+
+	v = vault(v)
+
+	return &v, nil
+}
+
+func (m *Memory) GetVaultByName(ctx context.Context, name string) (*Vault, error) {
+	defer m.lock()()
+
+	for _, v := range m.data.vaults {
+		if v.Name == name {
+			v = vault(v)
+			return &v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("error fetching vault %v: not found", name)
+}
+
+func (m *Memory) CreateVaults(ctx context.Context, vaults []Vault) ([]Vault, error) {
+	defer m.lock()()
+
+	created := make([]Vault, 0, len(vaults))
+
+	for _, vault := range vaults {
+		v, ok := m.vaultByName(vault.Name)
+
+		if !ok {
+			v = Vault{ID: m.data.nextID(), Name: vault.Name}
+		}
+
+		v.ActorsScanState = m.takeScanState(v.ActorsScanState, vault.ActorsScanState)
+
+		m.data.vaults[v.ID] = v
+		created = append(created, Vault{ID: v.ID, Name: v.Name})
+	}
+
+	return created, nil
+}
+
+func (m *Memory) vaultByName(name string) (Vault, bool) {
+	for _, v := range m.data.vaults {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return Vault{}, false
+}
+
+func (m *Memory) DeleteVaultsExcept(ctx context.Context, names []string) ([]string, error) {
+	defer m.lock()()
+
+	var deleted []string
+
+	for _, v := range m.sortedVaults() {
+		if slices.Contains(names, v.Name) {
+			continue
+		}
+
+		for _, c := range m.data.collections {
+			if c.VaultID == v.ID {
+				m.deleteCollection(c.ID)
+			}
+		}
+
+		for _, g := range m.data.galleries {
+			if g.VaultID == v.ID {
+				m.deleteGallery(g.ID)
+			}
+		}
+
+		delete(m.data.vaults, v.ID)
+		deleted = append(deleted, v.Name)
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) sortedVaults() []Vault {
+	return sortedRows(m.data.vaults, func(a, b Vault) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func (m *Memory) GetCollections(ctx context.Context, vaultId int) ([]Collection, error) {
+	defer m.lock()()
+
+	var collections []Collection
+
+	for _, c := range m.sortedCollections() {
+		if c.VaultID != vaultId {
+			continue
+		}
+
+		collections = append(collections, Collection{
+			ID:        c.ID,
+			Name:      c.Name,
+			VaultName: m.data.vaults[c.VaultID].Name,
+		})
+	}
+
+	return collections, nil
+}
+
+func (m *Memory) sortedCollections() []Collection {
+	return sortedRows(m.data.collections, func(a, b Collection) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func (m *Memory) CreateCollections(ctx context.Context, collections []Collection) ([]Collection, error) {
+	defer m.lock()()
+
+	created := make([]Collection, 0, len(collections))
+
+	for _, collection := range collections {
+		if _, ok := m.data.vaults[collection.VaultID]; !ok {
+			return nil, fmt.Errorf("vault %v of collection %v not found", collection.VaultID, collection.Name)
+		}
+
+		c, ok := m.collection(collection.VaultID, collection.Name)
+
+		if ok {
+			c.Path = collection.Path
+		} else {
+			c = Collection{
+				ID:      m.data.nextID(),
+				Name:    collection.Name,
+				Slug:    collection.Slug,
+				Path:    collection.Path,
+				VaultID: collection.VaultID,
+			}
+		}
+
+		c.ScanState = m.takeScanState(c.ScanState, collection.ScanState)
+
+		m.data.collections[c.ID] = c
+
+		c.ScanState = nil
+		created = append(created, c)
+	}
+
+	return created, nil
+}
+
+func (m *Memory) collection(vaultId int, name string) (Collection, bool) {
+	for _, c := range m.data.collections {
+		if c.VaultID == vaultId && c.Name == name {
+			return c, true
+		}
+	}
+
+	return Collection{}, false
+}
+
+func (m *Memory) DeleteCollectionsExcept(ctx context.Context, vaultId int, names []string) ([]string, error) {
+	defer m.lock()()
+
+	var deleted []string
+
+	for _, c := range m.sortedCollections() {
+		if c.VaultID != vaultId || slices.Contains(names, c.Name) {
+			continue
+		}
+
+		m.deleteCollection(c.ID)
+		deleted = append(deleted, c.Name)
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) deleteCollection(collectionId int) {
+	for _, v := range m.data.videos {
+		if v.CollectionID == collectionId {
+			delete(m.data.videos, v.ID)
+		}
+	}
+
+	delete(m.data.collections, collectionId)
+}
+
+func (m *Memory) GetVideos(ctx context.Context, collectionId int) ([]Video, error) {
+	defer m.lock()()
+
+	var videos []Video
+
+	for _, v := range m.sortedVideos() {
+		if v.CollectionID == collectionId {
+			videos = append(videos, m.video(v))
+		}
+	}
+
+	return videos, nil
+}
+
+func (m *Memory) sortedVideos() []Video {
+	return sortedRows(m.data.videos, func(a, b Video) int {
+		return cmp.Or(cmp.Compare(a.Title, b.Title), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+func (m *Memory) GetVideo(ctx context.Context, videoId int) (*Video, error) {
+	defer m.lock()()
+
+	v, ok := m.data.videos[videoId]
+
+	if !ok {
+		return nil, fmt.Errorf("error fetching video %v: not found", videoId)
+	}
+
+	v = m.video(v)
+
+	return &v, nil
+}
+
+// video fills in what the Postgres store joins to a video, in the same
+// order, and leaves out what it doesn't select.
+func (m *Memory) video(v Video) Video {
+	c := m.data.collections[v.CollectionID]
+
+	v.CollectionName = c.Name
+	v.VaultID = c.VaultID
+	v.VaultName = m.data.vaults[c.VaultID].Name
+	v.PosterPath = ""
+	v.ScanState = nil
+
+	v.Ratings = slices.SortedStableFunc(slices.Values(v.Ratings), func(a, b Rating) int {
+		return cmp.Or(compareDefault(a.Default, b.Default), cmp.Compare(a.Name, b.Name))
+	})
+
+	v.UniqueIDs = sortUniqueIDs(v.UniqueIDs)
+
+	v.Files = slices.SortedStableFunc(slices.Values(v.Files), func(a, b VideoFile) int {
+		return cmp.Or(cmp.Compare(a.Part, b.Part), cmp.Compare(a.Path, b.Path))
+	})
+
+	subtitles := make([]Subtitle, len(v.Subtitles))
+
+	for i, s := range v.Subtitles {
+		s.Path = ""
+		subtitles[i] = s
+	}
+
+	v.Subtitles = slices.SortedStableFunc(slices.Values(subtitles), func(a, b Subtitle) int {
+		return cmp.Or(
+			compareDefault(a.Default, b.Default),
+			cmp.Compare(a.Language, b.Language),
+			compareBool(a.Forced, b.Forced),
+			compareBool(a.SDH, b.SDH),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	v.Tags = slices.Sorted(slices.Values(v.Tags))
+
+	actors := make([]Actor, len(v.Actors))
+
+	for i, link := range v.Actors {
+		a := m.data.actors[link.ID]
+
+		actors[i] = Actor{
+			ID:    a.ID,
+			Name:  a.Name,
+			Slug:  a.Slug,
+			Role:  link.Role,
+			Order: link.Order,
+			Thumb: link.Thumb,
+		}
+	}
+
+	v.Actors = slices.SortedStableFunc(slices.Values(actors), func(a, b Actor) int {
+		return cmp.Or(cmp.Compare(a.Order, b.Order), cmp.Compare(a.Name, b.Name))
+	})
+
+	v.Ratings = orEmpty(v.Ratings)
+	v.UniqueIDs = orEmpty(v.UniqueIDs)
+	v.Artwork = orEmpty(v.Artwork)
+	v.Directors = orEmpty(v.Directors)
+	v.Credits = orEmpty(v.Credits)
+	v.Genres = orEmpty(v.Genres)
+	v.Countries = orEmpty(v.Countries)
+
+	return v
+}
+
+// compareDefault puts defaults first.
+func compareDefault(a, b bool) int {
+	return -compareBool(a, b)
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func sortUniqueIDs(ids []UniqueID) []UniqueID {
+	return orEmpty(slices.SortedStableFunc(slices.Values(ids), func(a, b UniqueID) int {
+		return cmp.Or(compareDefault(a.Default, b.Default), cmp.Compare(a.Type, b.Type))
+	}))
+}
+
+func (m *Memory) GetVideoPoster(ctx context.Context, videoId int) (string, error) {
+	defer m.lock()()
+
+	v, ok := m.data.videos[videoId]
+
+	if !ok {
+		return "", fmt.Errorf("error fetching video poster: video %v not found", videoId)
+	}
+
+	return v.PosterPath, nil
+}
+
+func (m *Memory) GetSubtitle(ctx context.Context, subtitleId int) (*Subtitle, error) {
+	defer m.lock()()
+
+	for _, v := range m.data.videos {
+		for _, s := range v.Subtitles {
+			if s.ID == subtitleId {
+				return &s, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("error fetching subtitle %v: not found", subtitleId)
+}
+
+func (m *Memory) GetScanStates(ctx context.Context, dir string) (map[string]ScanState, error) {
+	defer m.lock()()
+
+	states := map[string]ScanState{}
+
+	add := func(state *ScanState) {
+		if state != nil && strings.HasPrefix(state.Path, dir) {
+			states[state.Path] = *state
+		}
+	}
+
+	for _, v := range m.data.vaults {
+		add(v.ActorsScanState)
+	}
+
+	for _, c := range m.data.collections {
+		add(c.ScanState)
+	}
+
+	for _, g := range m.data.galleries {
+		add(g.ScanState)
+	}
+
+	for _, v := range m.data.videos {
+		add(v.ScanState)
+	}
+
+	return states, nil
+}
+
+func (m *Memory) CreateVideos(ctx context.Context, videos []Video) error {
+	defer m.lock()()
+
+	for _, video := range uniqueByFolder(videos) {
+		if _, ok := m.data.collections[video.CollectionID]; !ok {
+			return fmt.Errorf("collection %v of video %v not found", video.CollectionID, video.Slug)
+		}
+
+		var previous Video
+		found := false
+
+		for _, v := range m.data.videos {
+			if v.CollectionID == video.CollectionID && v.Slug == video.Slug {
+				previous, found = v, true
+				break
+			}
+		}
+
+		if found {
+			video.ID = previous.ID
+		} else {
+			video.ID = m.data.nextID()
+		}
+
+		video.Files = m.keepFileIDs(previous.Files, video.Files)
+		video.Subtitles = m.keepSubtitleIDs(previous.Subtitles, video.Subtitles)
+		video.Tags = m.linkTags(video.Tags)
+		video.Actors = m.linkActors(video.Actors)
+
+		video.ScanState = m.takeScanState(previous.ScanState, video.ScanState)
+
+		video.CollectionName = ""
+		video.VaultID = 0
+		video.VaultName = ""
+
+		m.data.videos[video.ID] = video
+	}
+
+	return nil
+}
+
+func (m *Memory) keepFileIDs(previous []VideoFile, files []VideoFile) []VideoFile {
+	kept := make([]VideoFile, len(files))
+
+	for i, f := range files {
+		f.ID = 0
+
+		for _, p := range previous {
+			if p.Path == f.Path {
+				f.ID = p.ID
+			}
+		}
+
+		if f.ID == 0 {
+			f.ID = m.data.nextID()
+		}
+
+		kept[i] = f
+	}
+
+	return kept
+}
+
+func (m *Memory) keepSubtitleIDs(previous []Subtitle, subtitles []Subtitle) []Subtitle {
+	kept := make([]Subtitle, len(subtitles))
+
+	for i, s := range subtitles {
+		s.ID = 0
+
+		for _, p := range previous {
+			if p.Path == s.Path {
+				s.ID = p.ID
+			}
+		}
+
+		if s.ID == 0 {
+			s.ID = m.data.nextID()
+		}
+
+		kept[i] = s
+	}
+
+	return kept
+}
+
+// linkTags creates the tags that don't exist yet and returns each of them
+// once.
+func (m *Memory) linkTags(tags []string) []string {
+	var linked []string
+
+	for _, tag := range tags {
+		if slices.Contains(linked, tag) {
+			continue
+		}
+
+		if !slices.Contains(slices.Collect(maps.Values(m.data.tags)), tag) {
+			m.data.tags[m.data.nextID()] = tag
+		}
+
+		linked = append(linked, tag)
+	}
+
+	return linked
+}
+
+// linkActors finds or creates the credited actors by name and returns a
+// link to each of them, with the part they are listed with last.
+func (m *Memory) linkActors(actors []Actor) []Actor {
+	var links []Actor
+
+	for _, actor := range actors {
+		slug := utils.TitleToSnake(actor.Name)
+		a, ok := m.actorBySlug(slug)
+
+		if !ok {
+			a = Actor{
+				ID:   m.data.nextID(),
+				Name: actor.Name,
+				Slug: slug,
+			}
+
+			m.data.actors[a.ID] = a
+		}
+
+		link := Actor{ID: a.ID, Role: actor.Role, Order: actor.Order, Thumb: actor.Thumb}
+
+		links = slices.DeleteFunc(links, func(l Actor) bool {
+			return l.ID == a.ID
+		})
+
+		links = append(links, link)
+	}
+
+	return links
+}
+
+func (m *Memory) actorBySlug(slug string) (Actor, bool) {
+	for _, a := range m.data.actors {
+		if a.Slug == slug {
+			return a, true
+		}
+	}
+
+	return Actor{}, false
+}
+
+// takeScanState returns the scan state a row keeps: the previous one when
+// it has no new one, or else a copy of the new one, which is taken away
+// from whatever it belonged to before.
+func (m *Memory) takeScanState(previous, state *ScanState) *ScanState {
+	if state == nil {
+		return previous
+	}
+
+	m.releaseScanState(state.Path)
+
+	c := *state
+	return &c
+}
+
+// releaseScanState takes a folder's scan state away from the row it
+// belonged to.
+func (m *Memory) releaseScanState(path string) {
+	owns := func(state *ScanState) bool {
+		return state != nil && state.Path == path
+	}
+
+	for _, v := range m.data.vaults {
+		if owns(v.ActorsScanState) {
+			v.ActorsScanState = nil
+			m.data.vaults[v.ID] = v
+		}
+	}
+
+	for _, c := range m.data.collections {
+		if owns(c.ScanState) {
+			c.ScanState = nil
+			m.data.collections[c.ID] = c
+		}
+	}
+
+	for _, g := range m.data.galleries {
+		if owns(g.ScanState) {
+			g.ScanState = nil
+			m.data.galleries[g.ID] = g
+		}
+	}
+
+	for _, v := range m.data.videos {
+		if owns(v.ScanState) {
+			v.ScanState = nil
+			m.data.videos[v.ID] = v
+		}
+	}
+}
+
+func (m *Memory) DeleteVideosExcept(ctx context.Context, vaultId int, collectionName string, slugs []string) ([]string, error) {
+	defer m.lock()()
+
+	c, ok := m.collection(vaultId, collectionName)
+
+	if !ok {
+		return nil, nil
+	}
+
+	var deleted []string
+
+	for _, v := range m.sortedVideos() {
+		if v.CollectionID != c.ID || slices.Contains(slugs, v.Slug) {
+			continue
+		}
+
+		delete(m.data.videos, v.ID)
+		deleted = append(deleted, v.Title)
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) GetGalleries(ctx context.Context, vaultId int) ([]Gallery, error) {
+	defer m.lock()()
+
+	var galleries []Gallery
+
+	for _, g := range m.sortedGalleries() {
+		if g.VaultID == vaultId && g.ParentID == nil {
+			galleries = append(galleries, m.gallery(g))
+		}
+	}
+
+	return galleries, nil
+}
+
+func (m *Memory) sortedGalleries() []Gallery {
+	return sortedRows(m.data.galleries, func(a, b Gallery) int {
+		return cmp.Compare(a.Slug, b.Slug)
+	})
+}
+
+func (m *Memory) GetGallery(ctx context.Context, galleryId int) (*Gallery, error) {
+	defer m.lock()()
+
+	g, ok := m.data.galleries[galleryId]
+
+	if !ok {
+		return nil, fmt.Errorf("error fetching gallery %v: not found", galleryId)
+	}
+
+	g = m.gallery(g)
+
+	// Walk up to the top of the vault and back down.
+	for p := &g; ; {
+		g.Breadcrumbs = slices.Insert(g.Breadcrumbs, 0, Breadcrumb{ID: p.ID, Title: p.Title, Slug: p.Slug})
+
+		if p.ParentID == nil {
+			break
+		}
+
+		parent := m.data.galleries[*p.ParentID]
+		p = &parent
+	}
+
+	return &g, nil
+}
+
+// gallery fills in the vault, children and capture dates of a gallery
+// like the Postgres store does.
+func (m *Memory) gallery(g Gallery) Gallery {
+	g.VaultName = m.data.vaults[g.VaultID].Name
+	g.ScanState = nil
+	g.Children = []Gallery{}
+
+	for _, c := range m.sortedGalleries() {
+		if c.ParentID != nil && *c.ParentID == g.ID {
+			g.Children = append(g.Children, Gallery{
+				ID:              c.ID,
+				Title:           c.Title,
+				Slug:            c.Slug,
+				ParentID:        c.ParentID,
+				ImageCount:      c.ImageCount,
+				TotalImageCount: c.TotalImageCount,
+				Archive:         c.Archive,
+				VaultID:         c.VaultID,
+				VaultName:       g.VaultName,
+			})
+		}
+	}
+
+	for _, i := range m.data.images {
+		d := m.data.galleries[i.galleryID]
+
+		if d.VaultID != g.VaultID || (d.ID != g.ID && !strings.HasPrefix(d.Slug, g.Slug+"/")) {
+			continue
+		}
+
+		if i.EXIF == nil || i.EXIF.TakenAt == nil {
+			continue
+		}
+
+		taken := *i.EXIF.TakenAt
+
+		if g.TakenFrom == nil || taken.Before(*g.TakenFrom) {
+			g.TakenFrom = &taken
+		}
+
+		if g.TakenTo == nil || taken.After(*g.TakenTo) {
+			g.TakenTo = &taken
+		}
+	}
+
+	return g
+}
+
+func (m *Memory) GetGalleryImages(ctx context.Context, galleryId int, q ImageQuery) ([]GalleryImage, int, error) {
+	defer m.lock()()
+
+	var matches []GalleryImage
+
+	for _, i := range m.data.images {
+		if i.galleryID != galleryId {
+			continue
+		}
+
+		var taken *int64
+
+		if i.EXIF != nil && i.EXIF.TakenAt != nil {
+			t := i.EXIF.TakenAt.UnixNano()
+			taken = &t
+		}
+
+		if q.From != nil && (taken == nil || *taken < q.From.UnixNano()) {
+			continue
+		}
+
+		if q.To != nil && (taken == nil || *taken > q.To.UnixNano()) {
+			continue
+		}
+
+		matches = append(matches, i.GalleryImage)
+	}
+
+	slices.SortFunc(matches, func(a, b GalleryImage) int {
+		byName := cmp.Or(cmp.Compare(a.SortOrder, b.SortOrder), cmp.Compare(a.Filename, b.Filename))
+
+		if q.Sort != "taken" {
+			return byName
+		}
+
+		return cmp.Or(compareTaken(a, b), byName)
+	})
+
+	total := len(matches)
+	start := min(q.Offset, total)
+	end := min(start+q.Limit, total)
+
+	return append([]GalleryImage{}, matches[start:end]...), total, nil
+}
+
+// compareTaken orders images by capture date, with the ones that have
+// none last.
+func compareTaken(a, b GalleryImage) int {
+	at, bt := takenAt(a), takenAt(b)
+
+	switch {
+	case at == nil && bt == nil:
+		return 0
+	case at == nil:
+		return 1
+	case bt == nil:
+		return -1
+	default:
+		return at.Compare(*bt)
+	}
+}
+
+func takenAt(i GalleryImage) *time.Time {
+	if i.EXIF == nil {
+		return nil
+	}
+
+	return i.EXIF.TakenAt
+}
+
+func (m *Memory) GetGalleryImage(ctx context.Context, galleryId int, sortOrder int) (*GalleryImage, error) {
+	defer m.lock()()
+
+	for _, i := range m.data.images {
+		if i.galleryID == galleryId && i.SortOrder == sortOrder {
+			return &GalleryImage{
+				ID:        i.ID,
+				Filename:  i.Filename,
+				SortOrder: i.SortOrder,
+				Size:      i.Size,
+				Format:    i.Format,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("error fetching image %v of gallery %v: not found", sortOrder, galleryId)
+}
+
+func (m *Memory) GetImageFile(ctx context.Context, imageId int) (*ImageFile, error) {
+	defer m.lock()()
+
+	i, ok := m.data.images[imageId]
+
+	if !ok {
+		return nil, fmt.Errorf("error fetching image %v: not found", imageId)
+	}
+
+	g := m.data.galleries[i.galleryID]
+
+	f := &ImageFile{
+		Filename:    i.Filename,
+		GalleryPath: g.Path,
+		Archive:     g.Archive,
+	}
+
+	if i.EXIF != nil {
+		f.Orientation = i.EXIF.Orientation
+	}
+
+	return f, nil
+}
+
+func (m *Memory) CreateGallery(ctx context.Context, galleries []Gallery) ([]Gallery, error) {
+	defer m.lock()()
+
+	created := make([]Gallery, 0, len(galleries))
+
+	for _, gallery := range galleries {
+		if _, ok := m.data.vaults[gallery.VaultID]; !ok {
+			return nil, fmt.Errorf("vault %v of gallery %v not found", gallery.VaultID, gallery.Slug)
+		}
+
+		g, ok := m.galleryBySlug(gallery.VaultID, gallery.Slug)
+
+		if !ok {
+			g = Gallery{ID: m.data.nextID(), Slug: gallery.Slug, VaultID: gallery.VaultID}
+		}
+
+		g.Title = gallery.Title
+		g.ImageCount = gallery.ImageCount
+		g.TotalImageCount = gallery.TotalImageCount
+		g.Path = gallery.Path
+		g.Archive = gallery.Archive
+		g.ScanState = m.takeScanState(g.ScanState, gallery.ScanState)
+
+		m.data.galleries[g.ID] = g
+
+		created = append(created, Gallery{
+			ID:              g.ID,
+			Title:           g.Title,
+			Slug:            g.Slug,
+			ImageCount:      g.ImageCount,
+			TotalImageCount: g.TotalImageCount,
+			VaultID:         g.VaultID,
+		})
+	}
+
+	// Now that every gallery has an ID the nested ones can point
+	// to their parent.
+	for _, gallery := range galleries {
+		g, _ := m.galleryBySlug(gallery.VaultID, gallery.Slug)
+		g.ParentID = nil
+
+		if p, ok := m.galleryBySlug(gallery.VaultID, gallery.ParentSlug); ok && gallery.ParentSlug != "" {
+			g.ParentID = &p.ID
+		}
+
+		m.data.galleries[g.ID] = g
+	}
+
+	return created, nil
+}
+
+func (m *Memory) galleryBySlug(vaultId int, slug string) (Gallery, bool) {
+	for _, g := range m.data.galleries {
+		if g.VaultID == vaultId && g.Slug == slug {
+			return g, true
+		}
+	}
+
+	return Gallery{}, false
+}
+
+func (m *Memory) CreateGalleryImages(ctx context.Context, galleryId int, images []GalleryImage) error {
+	defer m.lock()()
+
+	if _, ok := m.data.galleries[galleryId]; !ok {
+		return fmt.Errorf("failed to add images to gallery %v: not found", galleryId)
+	}
+
+	previous := map[string]int{}
+
+	for _, i := range m.data.images {
+		if i.galleryID == galleryId {
+			previous[i.Filename] = i.ID
+			delete(m.data.images, i.ID)
+		}
+	}
+
+	for _, image := range images {
+		id, ok := previous[image.Filename]
+
+		if !ok {
+			id = m.data.nextID()
+		}
+
+		image.ID = id
+		m.data.images[id] = memoryImage{GalleryImage: image, galleryID: galleryId}
+	}
+
+	return nil
+}
+
+func (m *Memory) DeleteGalleriesExcept(ctx context.Context, vaultId int, slugs []string, skipped []string) ([]string, error) {
+	defer m.lock()()
+
+	var deleted []string
+
+	for _, g := range m.sortedGalleries() {
+		if g.VaultID != vaultId || slices.Contains(slugs, g.Slug) {
+			continue
+		}
+
+		kept := slices.ContainsFunc(skipped, func(s string) bool {
+			return g.Slug == s || strings.HasPrefix(g.Slug, s+"/")
+		})
+
+		if kept {
+			continue
+		}
+
+		if _, ok := m.data.galleries[g.ID]; ok {
+			m.deleteGallery(g.ID)
+		}
+
+		deleted = append(deleted, g.Title)
+	}
+
+	return deleted, nil
+}
+
+// deleteGallery removes a gallery along with its images and the galleries
+// nested in it.
+func (m *Memory) deleteGallery(galleryId int) {
+	for _, i := range m.data.images {
+		if i.galleryID == galleryId {
+			delete(m.data.images, i.ID)
+		}
+	}
+
+	delete(m.data.galleries, galleryId)
+
+	for _, g := range m.data.galleries {
+		if g.ParentID != nil && *g.ParentID == galleryId {
+			m.deleteGallery(g.ID)
+		}
+	}
+}
+
+func (m *Memory) GetActors(ctx context.Context, vaultId int) ([]Actor, error) {
+	defer m.lock()()
+
+	inVault := map[int]bool{}
+
+	for _, v := range m.data.videos {
+		if m.data.collections[v.CollectionID].VaultID != vaultId {
+			continue
+		}
+
+		for _, link := range v.Actors {
+			inVault[link.ID] = true
+		}
+	}
+
+	var actors []Actor
+
+	for _, a := range m.sortedActors() {
+		if inVault[a.ID] {
+			actors = append(actors, Actor{
+				ID:       a.ID,
+				Name:     a.Name,
+				Slug:     a.Slug,
+				HasPhoto: a.PhotoPath != "",
+			})
+		}
+	}
+
+	return actors, nil
+}
+
+func (m *Memory) sortedActors() []Actor {
+	return sortedRows(m.data.actors, func(a, b Actor) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+func (m *Memory) GetActorByID(ctx context.Context, actorId int) (*Actor, error) {
+	defer m.lock()()
+
+	a, ok := m.data.actors[actorId]
+
+	if !ok {
+		return nil, fmt.Errorf("error fetching actor %v: not found", actorId)
+	}
+
+	a.HasPhoto = a.PhotoPath != ""
+	a.PhotoPath = ""
+	a.Aliases = orEmpty(a.Aliases)
+	a.UniqueIDs = sortUniqueIDs(a.UniqueIDs)
+
+	return &a, nil
+}
+
+func (m *Memory) GetActorVideos(ctx context.Context, actorId int) ([]ActorVideo, error) {
+	defer m.lock()()
+
+	videos := []ActorVideo{}
+
+	for _, v := range m.data.videos {
+		for _, link := range v.Actors {
+			if link.ID != actorId {
+				continue
+			}
+
+			videos = append(videos, ActorVideo{
+				ID:           v.ID,
+				Title:        v.Title,
+				Slug:         v.Slug,
+				Year:         v.Year,
+				Role:         link.Role,
+				CollectionID: v.CollectionID,
+			})
+		}
+	}
+
+	// Newest first, with the videos without a year last.
+	slices.SortFunc(videos, func(a, b ActorVideo) int {
+		if (a.Year == 0) != (b.Year == 0) {
+			return compareBool(a.Year == 0, b.Year == 0)
+		}
+
+		return cmp.Or(cmp.Compare(b.Year, a.Year), cmp.Compare(a.Title, b.Title))
+	})
+
+	return videos, nil
+}
+
+func (m *Memory) GetActorPhoto(ctx context.Context, actorId int) (string, error) {
+	defer m.lock()()
+
+	a, ok := m.data.actors[actorId]
+
+	if !ok {
+		return "", fmt.Errorf("error fetching actor photo: actor %v not found", actorId)
+	}
+
+	return a.PhotoPath, nil
+}
+
+func (m *Memory) CreateActor(ctx context.Context, actor Actor) (*int, error) {
+	defer m.lock()()
+
+	a, ok := m.actorBySlug(actor.Slug)
+	id := a.ID
+
+	if !ok {
+		id = m.data.nextID()
+	}
+
+	m.data.actors[id] = Actor{
+		ID:         id,
+		Name:       actor.Name,
+		Slug:       actor.Slug,
+		Biography:  actor.Biography,
+		Birthdate:  actor.Birthdate,
+		Birthplace: actor.Birthplace,
+		Aliases:    slices.Clone(actor.Aliases),
+		UniqueIDs:  slices.Clone(actor.UniqueIDs),
+		PhotoPath:  actor.PhotoPath,
+	}
+
+	return &id, nil
+}
+
+func (m *Memory) DeleteOrphanActors(ctx context.Context, keepSlugs []string) ([]string, error) {
+	defer m.lock()()
+
+	linked := map[int]bool{}
+
+	for _, v := range m.data.videos {
+		for _, link := range v.Actors {
+			linked[link.ID] = true
+		}
+	}
+
+	var deleted []string
+
+	for _, a := range m.sortedActors() {
+		if linked[a.ID] || slices.Contains(keepSlugs, a.Slug) {
+			continue
+		}
+
+		delete(m.data.actors, a.ID)
+		deleted = append(deleted, a.Name)
+	}
+
+	return deleted, nil
+}
+
+func (m *Memory) DeleteOrphanTags(ctx context.Context) ([]string, error) {
+	defer m.lock()()
+
+	linked := map[string]bool{}
+
+	for _, v := range m.data.videos {
+		for _, tag := range v.Tags {
+			linked[tag] = true
+		}
+	}
+
+	var deleted []string
+
+	for id, tag := range m.data.tags {
+		if !linked[tag] {
+			delete(m.data.tags, id)
+			deleted = append(deleted, tag)
+		}
+	}
+
+	slices.Sort(deleted)
+
+	return deleted, nil
+}
+
+func (m *Memory) GetLatestScanReport(ctx context.Context) (*ScanReport, error) {
+	defer m.lock()()
+
+	if len(m.data.reports) == 0 {
+		return nil, fmt.Errorf("error fetching scan report: not found")
+	}
+
+	latest := slices.MaxFunc(m.data.reports, func(a, b ScanReport) int {
+		return a.FinishedAt.Compare(b.FinishedAt)
+	})
+
+	return &latest, nil
+}
+
+func (m *Memory) CreateScanReport(ctx context.Context, report ScanReport) (*int, error) {
+	defer m.lock()()
+
+	report.ID = m.data.nextID()
+	report.Issues = slices.Clone(report.Issues)
+	m.data.reports = append(m.data.reports, report)
+
+	return &report.ID, nil
+}
+
+func (m *Memory) GetDuplicates(ctx context.Context) ([]DuplicateGroup, error) {
+	defer m.lock()()
+
+	groups := map[string]*DuplicateGroup{}
+	owners := map[string]map[string]bool{}
+
+	group := func(oshash string, owner string) *DuplicateGroup {
+		if groups[oshash] == nil {
+			groups[oshash] = &DuplicateGroup{OSHash: oshash, Videos: []DuplicateVideo{}, Images: []DuplicateImage{}}
+			owners[oshash] = map[string]bool{}
+		}
+
+		owners[oshash][owner] = true
+
+		return groups[oshash]
+	}
+
+	for _, v := range m.data.videos {
+		c := m.data.collections[v.CollectionID]
+		vault := m.data.vaults[c.VaultID]
+
+		for _, f := range v.Files {
+			if f.OSHash == "" {
+				continue
+			}
+
+			g := group(f.OSHash, fmt.Sprintf("video:%v", v.ID))
+
+			g.Videos = append(g.Videos, DuplicateVideo{
+				VideoID:        v.ID,
+				Title:          v.Title,
+				Path:           f.Path,
+				Size:           f.Size,
+				SHA256:         f.SHA256,
+				CollectionID:   c.ID,
+				CollectionName: c.Name,
+				VaultID:        vault.ID,
+				VaultName:      vault.Name,
+			})
+		}
+	}
+
+	for _, i := range m.data.images {
+		if i.OSHash == "" {
+			continue
+		}
+
+		gallery := m.data.galleries[i.galleryID]
+		vault := m.data.vaults[gallery.VaultID]
+
+		g := group(i.OSHash, fmt.Sprintf("image:%v", i.ID))
+
+		g.Images = append(g.Images, DuplicateImage{
+			ImageID:      i.ID,
+			Filename:     i.Filename,
+			SHA256:       i.SHA256,
+			GalleryID:    gallery.ID,
+			GalleryTitle: gallery.Title,
+			VaultID:      vault.ID,
+			VaultName:    vault.Name,
+		})
+	}
+
+	duplicates := []DuplicateGroup{}
+
+	for _, oshash := range slices.Sorted(maps.Keys(groups)) {
+		if len(owners[oshash]) < 2 {
+			continue
+		}
+
+		g := groups[oshash]
+
+		slices.SortFunc(g.Videos, func(a, b DuplicateVideo) int {
+			return cmp.Or(
+				cmp.Compare(a.VaultName, b.VaultName),
+				cmp.Compare(a.CollectionName, b.CollectionName),
+				cmp.Compare(a.Path, b.Path),
+			)
+		})
+
+		slices.SortFunc(g.Images, func(a, b DuplicateImage) int {
+			return cmp.Or(
+				cmp.Compare(a.VaultName, b.VaultName),
+				cmp.Compare(a.GalleryTitle, b.GalleryTitle),
+				cmp.Compare(a.Filename, b.Filename),
+			)
+		})
+
+		duplicates = append(duplicates, *g)
+	}
+
+	return duplicates, nil
+}
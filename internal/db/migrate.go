@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationRegex matches migration files, e.g. 0002_add_ratings.up.sql.
+var migrationRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLock keeps two instances from migrating at the same time.
+const migrationLock = 7250301
+
+// Migration is a versioned change to the schema along with the change
+// that undoes it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration along with when it was applied, which
+// is nil when it is still pending.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+// Migrations returns the migrations embedded in the binary, oldest first.
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, file := range files {
+		match := migrationRegex.FindStringSubmatch(file.Name())
+
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %v", file.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		sql, err := fs.ReadFile(migrationFiles, "migrations/"+file.Name())
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %v: %w", file.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %v has two names: %v and %v", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v is missing its up or down file", m.Version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in a single transaction and
+// returns the ones it applied.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	migrations, err := Migrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	err = InTx(ctx, pool, func(tx pgx.Tx) error {
+		done, err := lockMigrations(ctx, tx)
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, m.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %04d_%v: %w", m.Version, m.Name, err)
+			}
+
+			_, err := tx.Exec(
+				ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				m.Version,
+				m.Name,
+			)
+
+			if err != nil {
+				return fmt.Errorf("failed to record migration %v: %w", m.Version, err)
+			}
+
+			applied = append(applied, m)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range applied {
+		log.Printf("migration applied: %04d_%v", m.Version, m.Name)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown undoes the latest applied migration and returns it, or nil
+// when there is nothing to undo.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool) (*Migration, error) {
+	migrations, err := Migrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var undone *Migration
+
+	err = InTx(ctx, pool, func(tx pgx.Tx) error {
+		done, err := lockMigrations(ctx, tx)
+
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return fmt.Errorf("failed to undo migration %04d_%v: %w", m.Version, m.Name, err)
+			}
+
+			_, err := tx.Exec(
+				ctx,
+				`DELETE FROM schema_migrations WHERE version = $1`,
+				m.Version,
+			)
+
+			if err != nil {
+				return fmt.Errorf("failed to record migration %v: %w", m.Version, err)
+			}
+
+			undone = &m
+
+			return nil
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if undone != nil {
+		log.Printf("migration undone: %04d_%v", undone.Version, undone.Name)
+	}
+
+	return undone, nil
+}
+
+// GetMigrationStatus lists every migration, applied or not, oldest first.
+func GetMigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var done map[int]time.Time
+
+	err = InTx(ctx, pool, func(tx pgx.Tx) error {
+		done, err = lockMigrations(ctx, tx)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+
+		if at, ok := done[m.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// lockMigrations makes sure schema_migrations exists, waits for any other
+// migration to finish and returns when each applied migration was applied.
+func lockMigrations(ctx context.Context, tx pgx.Tx) (map[int]time.Time, error) {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`
+
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT version, applied_at FROM schema_migrations`,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	done := map[int]time.Time{}
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+
+		done[version] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	return done, nil
+}
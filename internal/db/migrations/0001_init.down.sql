@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS galleries;
+DROP TABLE IF EXISTS video_actors;
+DROP TABLE IF EXISTS actors;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS vaults;
@@ -0,0 +1,7 @@
+-- Scan Reports Table
+CREATE TABLE IF NOT EXISTS scan_reports (
+    id          SERIAL PRIMARY KEY,
+    started_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    issues      JSONB NOT NULL DEFAULT '[]'
+);
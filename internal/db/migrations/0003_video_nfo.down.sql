@@ -0,0 +1,25 @@
+ALTER TABLE video_actors
+    DROP COLUMN IF EXISTS role,
+    DROP COLUMN IF EXISTS sort_order,
+    DROP COLUMN IF EXISTS thumb;
+
+DROP TABLE IF EXISTS video_artwork;
+DROP TABLE IF EXISTS video_unique_ids;
+DROP TABLE IF EXISTS video_ratings;
+
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS sort_title,
+    DROP COLUMN IF EXISTS plot,
+    DROP COLUMN IF EXISTS outline,
+    DROP COLUMN IF EXISTS tagline,
+    DROP COLUMN IF EXISTS year,
+    DROP COLUMN IF EXISTS premiered,
+    DROP COLUMN IF EXISTS runtime,
+    DROP COLUMN IF EXISTS user_rating,
+    DROP COLUMN IF EXISTS mpaa,
+    DROP COLUMN IF EXISTS directors,
+    DROP COLUMN IF EXISTS credits,
+    DROP COLUMN IF EXISTS genres,
+    DROP COLUMN IF EXISTS countries,
+    DROP COLUMN IF EXISTS set_name,
+    DROP COLUMN IF EXISTS set_overview;
@@ -0,0 +1,55 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS sort_title     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS plot           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS outline        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tagline        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS year           INTEGER,
+    ADD COLUMN IF NOT EXISTS premiered      DATE,
+    ADD COLUMN IF NOT EXISTS runtime        INTEGER,
+    ADD COLUMN IF NOT EXISTS user_rating    DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS mpaa           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS directors      TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS credits        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS genres         TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS countries      TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS set_name       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS set_overview   TEXT NOT NULL DEFAULT '';
+
+-- Video Ratings Table
+CREATE TABLE IF NOT EXISTS video_ratings (
+    video_id   INTEGER NOT NULL,
+    name       TEXT NOT NULL,
+    value      DOUBLE PRECISION NOT NULL,
+    votes      INTEGER NOT NULL DEFAULT 0,
+    max        INTEGER NOT NULL DEFAULT 10,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (video_id, name),
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+-- Video Unique IDs Table (imdb, tmdb, ...)
+CREATE TABLE IF NOT EXISTS video_unique_ids (
+    video_id   INTEGER NOT NULL,
+    type       TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (video_id, type),
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+-- Video Artwork Table (thumb and fanart references)
+CREATE TABLE IF NOT EXISTS video_artwork (
+    id         SERIAL PRIMARY KEY,
+    video_id   INTEGER NOT NULL,
+    kind       TEXT NOT NULL,
+    aspect     TEXT NOT NULL DEFAULT '',
+    url        TEXT NOT NULL,
+    preview    TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+    UNIQUE (video_id, kind, url)
+);
+
+ALTER TABLE video_actors
+    ADD COLUMN IF NOT EXISTS role       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS thumb      TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE videos
+    DROP COLUMN IF EXISTS container,
+    DROP COLUMN IF EXISTS duration,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS video_codec,
+    DROP COLUMN IF EXISTS audio_codecs,
+    DROP COLUMN IF EXISTS audio_languages,
+    DROP COLUMN IF EXISTS bitrate;
@@ -0,0 +1,9 @@
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS container       TEXT,
+    ADD COLUMN IF NOT EXISTS duration        DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS width           INTEGER,
+    ADD COLUMN IF NOT EXISTS height          INTEGER,
+    ADD COLUMN IF NOT EXISTS video_codec     TEXT,
+    ADD COLUMN IF NOT EXISTS audio_codecs    TEXT[],
+    ADD COLUMN IF NOT EXISTS audio_languages TEXT[],
+    ADD COLUMN IF NOT EXISTS bitrate         BIGINT;
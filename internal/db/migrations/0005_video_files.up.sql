@@ -0,0 +1,11 @@
+-- Video Files Table (one row per part of a multi-part video)
+CREATE TABLE IF NOT EXISTS video_files (
+    id         SERIAL PRIMARY KEY,
+    video_id   INTEGER NOT NULL,
+    path       TEXT NOT NULL,
+    size       BIGINT NOT NULL,
+    mtime      TIMESTAMPTZ NOT NULL,
+    part       INTEGER NOT NULL DEFAULT 1,
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+    UNIQUE (video_id, path)
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS gallery_images;
+
+DROP INDEX IF EXISTS video_files_sha256_idx;
+DROP INDEX IF EXISTS video_files_oshash_idx;
+
+ALTER TABLE video_files
+    DROP COLUMN IF EXISTS oshash,
+    DROP COLUMN IF EXISTS sha256;
@@ -0,0 +1,20 @@
+ALTER TABLE video_files
+    ADD COLUMN IF NOT EXISTS oshash TEXT,
+    ADD COLUMN IF NOT EXISTS sha256 TEXT;
+
+CREATE INDEX IF NOT EXISTS video_files_oshash_idx ON video_files (oshash);
+CREATE INDEX IF NOT EXISTS video_files_sha256_idx ON video_files (sha256);
+
+-- Gallery Images Table
+CREATE TABLE IF NOT EXISTS gallery_images (
+    id          SERIAL PRIMARY KEY,
+    gallery_id  INTEGER NOT NULL,
+    filename    TEXT NOT NULL,
+    oshash      TEXT,
+    sha256      TEXT,
+    FOREIGN KEY (gallery_id) REFERENCES galleries(id) ON DELETE CASCADE,
+    UNIQUE (gallery_id, filename)
+);
+
+CREATE INDEX IF NOT EXISTS gallery_images_oshash_idx ON gallery_images (oshash);
+CREATE INDEX IF NOT EXISTS gallery_images_sha256_idx ON gallery_images (sha256);
@@ -0,0 +1,14 @@
+-- Video Subtitles Table
+CREATE TABLE IF NOT EXISTS video_subtitles (
+    id          SERIAL PRIMARY KEY,
+    video_id    INTEGER NOT NULL,
+    path        TEXT NOT NULL,
+    language    TEXT NOT NULL DEFAULT '',
+    label       TEXT NOT NULL DEFAULT '',
+    format      TEXT NOT NULL,
+    forced      BOOLEAN NOT NULL DEFAULT FALSE,
+    sdh         BOOLEAN NOT NULL DEFAULT FALSE,
+    is_default  BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+    UNIQUE (video_id, path)
+);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS gallery_images_order_idx;
+
+ALTER TABLE gallery_images
+    DROP COLUMN IF EXISTS sort_order,
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS format;
@@ -0,0 +1,8 @@
+ALTER TABLE gallery_images
+    ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS size       BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS width      INTEGER,
+    ADD COLUMN IF NOT EXISTS height     INTEGER,
+    ADD COLUMN IF NOT EXISTS format     TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS gallery_images_order_idx ON gallery_images (gallery_id, sort_order);
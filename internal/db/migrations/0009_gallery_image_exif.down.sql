@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS gallery_images_taken_idx;
+
+ALTER TABLE gallery_images
+    DROP COLUMN IF EXISTS taken_at,
+    DROP COLUMN IF EXISTS camera_make,
+    DROP COLUMN IF EXISTS camera_model,
+    DROP COLUMN IF EXISTS lens,
+    DROP COLUMN IF EXISTS orientation,
+    DROP COLUMN IF EXISTS exposure_time,
+    DROP COLUMN IF EXISTS f_number,
+    DROP COLUMN IF EXISTS iso,
+    DROP COLUMN IF EXISTS focal_length,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS altitude;
@@ -0,0 +1,15 @@
+ALTER TABLE gallery_images
+    ADD COLUMN IF NOT EXISTS taken_at      TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS camera_make   TEXT,
+    ADD COLUMN IF NOT EXISTS camera_model  TEXT,
+    ADD COLUMN IF NOT EXISTS lens          TEXT,
+    ADD COLUMN IF NOT EXISTS orientation   INTEGER,
+    ADD COLUMN IF NOT EXISTS exposure_time TEXT,
+    ADD COLUMN IF NOT EXISTS f_number      DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS iso           INTEGER,
+    ADD COLUMN IF NOT EXISTS focal_length  DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS latitude      DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS longitude     DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS altitude      DOUBLE PRECISION;
+
+CREATE INDEX IF NOT EXISTS gallery_images_taken_idx ON gallery_images (gallery_id, taken_at);
@@ -0,0 +1,3 @@
+ALTER TABLE galleries
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS archive;
@@ -0,0 +1,3 @@
+ALTER TABLE galleries
+    ADD COLUMN IF NOT EXISTS path    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS archive BOOLEAN NOT NULL DEFAULT FALSE;
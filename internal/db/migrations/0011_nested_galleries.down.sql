@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS galleries_parent_idx;
+
+ALTER TABLE galleries
+    DROP CONSTRAINT IF EXISTS galleries_vault_id_slug_key,
+    ADD CONSTRAINT galleries_title_slug_key UNIQUE (title, slug),
+    DROP CONSTRAINT IF EXISTS galleries_parent_id_fkey,
+    DROP COLUMN IF EXISTS parent_id,
+    DROP COLUMN IF EXISTS total_image_count;
@@ -0,0 +1,9 @@
+ALTER TABLE galleries
+    ADD COLUMN IF NOT EXISTS total_image_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS parent_id         INTEGER,
+    ADD CONSTRAINT galleries_parent_id_fkey
+        FOREIGN KEY (parent_id) REFERENCES galleries(id) ON DELETE CASCADE,
+    DROP CONSTRAINT IF EXISTS galleries_title_slug_key,
+    ADD CONSTRAINT galleries_vault_id_slug_key UNIQUE (vault_id, slug);
+
+CREATE INDEX IF NOT EXISTS galleries_parent_idx ON galleries (parent_id);
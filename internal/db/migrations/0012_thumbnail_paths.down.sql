@@ -0,0 +1,2 @@
+ALTER TABLE actors DROP COLUMN IF EXISTS photo_path;
+ALTER TABLE videos DROP COLUMN IF EXISTS poster_path;
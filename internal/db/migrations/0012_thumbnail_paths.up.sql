@@ -0,0 +1,2 @@
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS poster_path TEXT;
+ALTER TABLE actors ADD COLUMN IF NOT EXISTS photo_path TEXT;
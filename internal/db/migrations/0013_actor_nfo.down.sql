@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS actor_unique_ids;
+
+ALTER TABLE actors
+    DROP COLUMN IF EXISTS biography,
+    DROP COLUMN IF EXISTS birthdate,
+    DROP COLUMN IF EXISTS birthplace,
+    DROP COLUMN IF EXISTS aliases;
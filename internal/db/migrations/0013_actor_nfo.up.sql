@@ -0,0 +1,15 @@
+ALTER TABLE actors
+    ADD COLUMN IF NOT EXISTS biography  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS birthdate  DATE,
+    ADD COLUMN IF NOT EXISTS birthplace TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS aliases    TEXT[] NOT NULL DEFAULT '{}';
+
+-- Actor Unique IDs Table (imdb, tmdb, ... ids from the actor's .nfo)
+CREATE TABLE IF NOT EXISTS actor_unique_ids (
+    actor_id   INTEGER NOT NULL,
+    type       TEXT NOT NULL,
+    value      TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (actor_id, type),
+    FOREIGN KEY (actor_id) REFERENCES actors(id) ON DELETE CASCADE
+);
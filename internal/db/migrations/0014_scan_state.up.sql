@@ -0,0 +1,9 @@
+-- Scan State Table (what each video folder looked like when last read)
+CREATE TABLE IF NOT EXISTS scan_state (
+    path          TEXT PRIMARY KEY,
+    video_id      INTEGER NOT NULL UNIQUE,
+    mtime         TIMESTAMPTZ NOT NULL,
+    size          BIGINT NOT NULL,
+    metadata_hash TEXT NOT NULL,
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS video_actors_actor_idx;
+DROP INDEX IF EXISTS video_tags_tag_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS video_tags_tag_idx ON video_tags (tag_id);
+CREATE INDEX IF NOT EXISTS video_actors_actor_idx ON video_actors (actor_id);
@@ -0,0 +1,8 @@
+DELETE FROM scan_state WHERE video_id IS NULL;
+
+ALTER TABLE scan_state
+    DROP CONSTRAINT IF EXISTS scan_state_owner_check,
+    DROP COLUMN IF EXISTS collection_id,
+    DROP COLUMN IF EXISTS gallery_id,
+    DROP COLUMN IF EXISTS vault_id,
+    ALTER COLUMN video_id SET NOT NULL;
@@ -0,0 +1,10 @@
+-- Collections, galleries and the actors folder of a vault are skipped
+-- when unchanged too, so a scan state belongs to exactly one of them or
+-- to a video.
+ALTER TABLE scan_state
+    ALTER COLUMN video_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS collection_id INTEGER UNIQUE REFERENCES collections(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS gallery_id    INTEGER UNIQUE REFERENCES galleries(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS vault_id      INTEGER UNIQUE REFERENCES vaults(id) ON DELETE CASCADE,
+    ADD CONSTRAINT scan_state_owner_check CHECK (num_nonnulls(video_id, collection_id, gallery_id, vault_id) = 1);
+
@@ -0,0 +1,9 @@
+-- Only the first copy of a video found in several collections is kept.
+DELETE FROM videos a
+USING videos b
+WHERE a.slug = b.slug
+AND a.id > b.id;
+
+ALTER TABLE videos
+    DROP CONSTRAINT IF EXISTS videos_collection_id_slug_key,
+    ADD CONSTRAINT videos_slug_key UNIQUE (slug);
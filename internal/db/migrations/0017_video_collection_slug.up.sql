@@ -0,0 +1,5 @@
+-- The same video folder may be in more than one collection, and each copy
+-- is a video of its own.
+ALTER TABLE videos
+    DROP CONSTRAINT IF EXISTS videos_slug_key,
+    ADD CONSTRAINT videos_collection_id_slug_key UNIQUE (collection_id, slug);
@@ -0,0 +1,3 @@
+ALTER TABLE actors
+    DROP CONSTRAINT IF EXISTS actors_slug_key,
+    ADD CONSTRAINT actors_name_slug_key UNIQUE (name, slug);
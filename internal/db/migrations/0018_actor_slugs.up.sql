@@ -0,0 +1,22 @@
+-- Actors are told apart by slug alone, so fixing the name in an actor's
+-- .nfo renames the actor rather than adding another one. Actors that only
+-- differ in name are merged into the oldest of them first.
+INSERT INTO video_actors (video_id, actor_id, role, sort_order, thumb)
+SELECT va.video_id, k.id, va.role, va.sort_order, va.thumb
+FROM video_actors va
+JOIN actors a ON a.id = va.actor_id
+JOIN (
+    SELECT slug, MIN(id) AS id
+    FROM actors
+    GROUP BY slug
+) k ON k.slug = a.slug AND k.id <> a.id
+ON CONFLICT DO NOTHING;
+
+DELETE FROM actors a
+USING actors b
+WHERE a.slug = b.slug
+AND a.id > b.id;
+
+ALTER TABLE actors
+    DROP CONSTRAINT IF EXISTS actors_name_slug_key,
+    ADD CONSTRAINT actors_slug_key UNIQUE (slug);
@@ -5,33 +5,93 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var db *pgxpool.Pool
+// Querier is what reads run on: the pool, or a transaction whose own
+// writes they should see.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
 
-func Connect(dbURL string) (*pgxpool.Pool, error) {
-	var err error
+// queryTimeout bounds each call that reads or writes through the pool.
+// Zero leaves them unbounded.
+var queryTimeout time.Duration
 
-	db, err = pgxpool.New(context.Background(), dbURL)
+// Connect opens a pool of connections to the database at dbURL and waits
+// for it to answer. The caller closes the pool.
+func Connect(ctx context.Context, dbURL string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dbURL)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	if err := db.Ping(ctx); err != nil {
-		db.Close()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("database not ready: %w", err)
 	}
 
-	return db, nil
+	return pool, nil
+}
+
+// SetQueryTimeout bounds how long a single call into the database may
+// take. Calls that run over fail with context.DeadlineExceeded.
+func SetQueryTimeout(timeout time.Duration) {
+	queryTimeout = timeout
+}
+
+// withQueryTimeout derives the context of a single call from ctx.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, queryTimeout)
 }
 
-func Close() {
-	if db != nil {
-		db.Close()
+// InTx runs fn in a transaction on pool, which is committed when fn
+// succeeds and rolled back when it fails.
+func InTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
 	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// nonNil makes sure a slice is sent to Postgres as an empty array rather
+// than NULL, which would make "= ANY(...)" comparisons match nothing.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
+
+// nullIfEmpty stores an empty string as NULL.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
 }
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ScanIssue struct {
+	Path     string `json:"path"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type ScanReport struct {
+	ID         int         `json:"id"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt time.Time   `json:"finishedAt"`
+	Issues     []ScanIssue `json:"issues"`
+}
+
+func CreateScanReport(ctx context.Context, report ScanReport, tx pgx.Tx) (*int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO scan_reports (started_at, finished_at, issues)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	var reportId int
+
+	err := tx.QueryRow(
+		ctx,
+		query,
+		report.StartedAt,
+		report.FinishedAt,
+		report.Issues,
+	).Scan(&reportId)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert scan report: %w", err)
+	}
+
+	return &reportId, nil
+}
+
+func GetLatestScanReport(ctx context.Context, conn Querier) (*ScanReport, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			id,
+			started_at,
+			finished_at,
+			issues
+		FROM
+			scan_reports
+		ORDER BY
+			finished_at DESC
+		LIMIT 1
+	`
+
+	var r ScanReport
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+	).Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Issues)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching scan report: %w", err)
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ScanState is what a folder looked like when it was last read, so a later
+// scan can tell whether it has to be read again. It belongs to the video,
+// collection or gallery read from the folder, or to the vault whose actors
+// folder it is.
+type ScanState struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+
+	// MetadataHash covers the names of the files that were read and
+	// how they were read.
+	MetadataHash string
+}
+
+// saveScanStates records the scan states of the rows in ids as part of
+// tx, see queueScanStates.
+func saveScanStates(ctx context.Context, column string, ids []int, states []*ScanState, tx pgx.Tx) error {
+	batch := &pgx.Batch{}
+
+	queueScanStates(batch, column, ids, states)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save scan states: %w", err)
+	}
+
+	return nil
+}
+
+// queueScanStates records the scan states of the rows in ids, which own
+// them through column: video_id, collection_id, gallery_id or vault_id.
+// Rows with a nil state keep the one they had.
+func queueScanStates(batch *pgx.Batch, column string, ids []int, states []*ScanState) {
+	var ownerIds []int
+	var paths, hashes []string
+	var mtimes []time.Time
+	var sizes []int64
+
+	for i, state := range states {
+		if state == nil {
+			continue
+		}
+
+		ownerIds = append(ownerIds, ids[i])
+		paths = append(paths, state.Path)
+		mtimes = append(mtimes, state.ModTime)
+		sizes = append(sizes, state.Size)
+		hashes = append(hashes, state.MetadataHash)
+	}
+
+	if len(ownerIds) == 0 {
+		return
+	}
+
+	batch.Queue(fmt.Sprintf(`DELETE FROM scan_state WHERE %v = ANY($1::int[])`, column), ownerIds)
+
+	query := fmt.Sprintf(`
+		INSERT INTO scan_state (path, %v, mtime, size, metadata_hash)
+		SELECT *
+		FROM UNNEST(
+			$1::text[],
+			$2::int[],
+			$3::timestamptz[],
+			$4::bigint[],
+			$5::text[]
+		)
+		ON CONFLICT (path) DO UPDATE SET
+			video_id = EXCLUDED.video_id,
+			collection_id = EXCLUDED.collection_id,
+			gallery_id = EXCLUDED.gallery_id,
+			vault_id = EXCLUDED.vault_id,
+			mtime = EXCLUDED.mtime,
+			size = EXCLUDED.size,
+			metadata_hash = EXCLUDED.metadata_hash
+	`, column)
+
+	batch.Queue(query, paths, ownerIds, mtimes, sizes, hashes)
+}
+
+// GetScanStates returns the scan states of the paths starting with dir by
+// path.
+func GetScanStates(ctx context.Context, dir string, conn Querier) (map[string]ScanState, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			path,
+			mtime,
+			size,
+			metadata_hash
+		FROM
+			scan_state
+		WHERE
+			starts_with(path, $1)
+	`
+
+	rows, err := conn.Query(
+		ctx,
+		query,
+		dir,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching scan states: %w", err)
+	}
+
+	states, err := pgx.CollectRows(rows, pgx.RowToStructByPos[ScanState])
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching scan states: %w", err)
+	}
+
+	byPath := make(map[string]ScanState, len(states))
+
+	for _, s := range states {
+		byPath[s.Path] = s
+	}
+
+	return byPath, nil
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// VaultStore holds the vaults of the library.
+type VaultStore interface {
+	GetVaults(ctx context.Context) ([]Vault, error)
+	GetVault(ctx context.Context, vaultId int) (*Vault, error)
+	GetVaultByName(ctx context.Context, name string) (*Vault, error)
+	CreateVaults(ctx context.Context, vaults []Vault) ([]Vault, error)
+	DeleteVaultsExcept(ctx context.Context, names []string) ([]string, error)
+}
+
+// CollectionStore holds the video collections of each vault.
+type CollectionStore interface {
+	GetCollections(ctx context.Context, vaultId int) ([]Collection, error)
+	CreateCollections(ctx context.Context, collections []Collection) ([]Collection, error)
+	DeleteCollectionsExcept(ctx context.Context, vaultId int, names []string) ([]string, error)
+}
+
+// VideoStore holds videos along with their files, subtitles and the
+// scan states of their folders.
+type VideoStore interface {
+	GetVideos(ctx context.Context, collectionId int) ([]Video, error)
+	GetVideo(ctx context.Context, videoId int) (*Video, error)
+	GetVideoPoster(ctx context.Context, videoId int) (string, error)
+	GetSubtitle(ctx context.Context, subtitleId int) (*Subtitle, error)
+	GetScanStates(ctx context.Context, dir string) (map[string]ScanState, error)
+	CreateVideos(ctx context.Context, videos []Video) error
+	DeleteVideosExcept(ctx context.Context, vaultId int, collectionName string, slugs []string) ([]string, error)
+}
+
+// GalleryStore holds the picture galleries of each vault and their images.
+type GalleryStore interface {
+	GetGalleries(ctx context.Context, vaultId int) ([]Gallery, error)
+	GetGallery(ctx context.Context, galleryId int) (*Gallery, error)
+	GetGalleryImages(ctx context.Context, galleryId int, q ImageQuery) ([]GalleryImage, int, error)
+	GetGalleryImage(ctx context.Context, galleryId int, sortOrder int) (*GalleryImage, error)
+	GetImageFile(ctx context.Context, imageId int) (*ImageFile, error)
+	CreateGallery(ctx context.Context, galleries []Gallery) ([]Gallery, error)
+	CreateGalleryImages(ctx context.Context, galleryId int, images []GalleryImage) error
+	DeleteGalleriesExcept(ctx context.Context, vaultId int, slugs []string, skipped []string) ([]string, error)
+}
+
+// ActorStore holds the actors shared by every vault.
+type ActorStore interface {
+	GetActors(ctx context.Context, vaultId int) ([]Actor, error)
+	GetActorByID(ctx context.Context, actorId int) (*Actor, error)
+	GetActorVideos(ctx context.Context, actorId int) ([]ActorVideo, error)
+	GetActorPhoto(ctx context.Context, actorId int) (string, error)
+	CreateActor(ctx context.Context, actor Actor) (*int, error)
+	DeleteOrphanActors(ctx context.Context, keepSlugs []string) ([]string, error)
+}
+
+// TagStore holds the tags that videos are linked to.
+type TagStore interface {
+	DeleteOrphanTags(ctx context.Context) ([]string, error)
+}
+
+// ReportStore holds what scans found beyond the library itself.
+type ReportStore interface {
+	GetLatestScanReport(ctx context.Context) (*ScanReport, error)
+	CreateScanReport(ctx context.Context, report ScanReport) (*int, error)
+	GetDuplicates(ctx context.Context) ([]DuplicateGroup, error)
+}
+
+// Store is everything the API and the scanner read and write.
+type Store interface {
+	VaultStore
+	CollectionStore
+	VideoStore
+	GalleryStore
+	ActorStore
+	TagStore
+	ReportStore
+
+	// InTx runs fn with a Store whose writes are committed together
+	// when fn succeeds and discarded when it fails.
+	InTx(ctx context.Context, fn func(store Store) error) error
+}
+
+// Postgres is the Store backed by a pool opened with Connect. Writes
+// outside of InTx run in a transaction of their own.
+type Postgres struct {
+	pool *pgxpool.Pool
+	tx   pgx.Tx
+}
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{pool: pool}
+}
+
+func (p *Postgres) InTx(ctx context.Context, fn func(store Store) error) error {
+	if p.tx != nil {
+		return fn(p)
+	}
+
+	return InTx(ctx, p.pool, func(tx pgx.Tx) error {
+		return fn(&Postgres{pool: p.pool, tx: tx})
+	})
+}
+
+// conn is what reads run on: the current transaction, so they see what it
+// has written so far, or the pool.
+func (p *Postgres) conn() Querier {
+	if p.tx != nil {
+		return p.tx
+	}
+
+	return p.pool
+}
+
+// write runs fn in the current transaction, or in a new one.
+func (p *Postgres) write(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	if p.tx != nil {
+		return fn(p.tx)
+	}
+
+	return InTx(ctx, p.pool, fn)
+}
+
+func (p *Postgres) GetVaults(ctx context.Context) ([]Vault, error) {
+	return GetVaults(ctx, p.conn())
+}
+
+func (p *Postgres) GetVault(ctx context.Context, vaultId int) (*Vault, error) {
+	return GetVault(ctx, vaultId, p.conn())
+}
+
+func (p *Postgres) GetVaultByName(ctx context.Context, name string) (*Vault, error) {
+	return GetVaultByName(ctx, name, p.conn())
+}
+
+func (p *Postgres) CreateVaults(ctx context.Context, vaults []Vault) (created []Vault, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		created, err = CreateVaults(ctx, vaults, tx)
+		return err
+	})
+
+	return created, err
+}
+
+func (p *Postgres) DeleteVaultsExcept(ctx context.Context, names []string) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteVaultsExcept(ctx, names, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) GetCollections(ctx context.Context, vaultId int) ([]Collection, error) {
+	return GetCollections(ctx, vaultId, p.conn())
+}
+
+func (p *Postgres) CreateCollections(ctx context.Context, collections []Collection) (created []Collection, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		created, err = CreateCollections(ctx, collections, tx)
+		return err
+	})
+
+	return created, err
+}
+
+func (p *Postgres) DeleteCollectionsExcept(ctx context.Context, vaultId int, names []string) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteCollectionsExcept(ctx, vaultId, names, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) GetVideos(ctx context.Context, collectionId int) ([]Video, error) {
+	return GetVideos(ctx, collectionId, p.conn())
+}
+
+func (p *Postgres) GetVideo(ctx context.Context, videoId int) (*Video, error) {
+	return GetVideo(ctx, videoId, p.conn())
+}
+
+func (p *Postgres) GetVideoPoster(ctx context.Context, videoId int) (string, error) {
+	return GetVideoPoster(ctx, videoId, p.conn())
+}
+
+func (p *Postgres) GetSubtitle(ctx context.Context, subtitleId int) (*Subtitle, error) {
+	return GetSubtitle(ctx, subtitleId, p.conn())
+}
+
+func (p *Postgres) GetScanStates(ctx context.Context, dir string) (map[string]ScanState, error) {
+	return GetScanStates(ctx, dir, p.conn())
+}
+
+func (p *Postgres) CreateVideos(ctx context.Context, videos []Video) error {
+	return p.write(ctx, func(tx pgx.Tx) error {
+		return CreateVideos(ctx, videos, tx)
+	})
+}
+
+func (p *Postgres) DeleteVideosExcept(ctx context.Context, vaultId int, collectionName string, slugs []string) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteVideosExcept(ctx, vaultId, collectionName, slugs, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) GetGalleries(ctx context.Context, vaultId int) ([]Gallery, error) {
+	return GetGalleries(ctx, vaultId, p.conn())
+}
+
+func (p *Postgres) GetGallery(ctx context.Context, galleryId int) (*Gallery, error) {
+	return GetGallery(ctx, galleryId, p.conn())
+}
+
+func (p *Postgres) GetGalleryImages(ctx context.Context, galleryId int, q ImageQuery) ([]GalleryImage, int, error) {
+	return GetGalleryImages(ctx, galleryId, q, p.conn())
+}
+
+func (p *Postgres) GetGalleryImage(ctx context.Context, galleryId int, sortOrder int) (*GalleryImage, error) {
+	return GetGalleryImage(ctx, galleryId, sortOrder, p.conn())
+}
+
+func (p *Postgres) GetImageFile(ctx context.Context, imageId int) (*ImageFile, error) {
+	return GetImageFile(ctx, imageId, p.conn())
+}
+
+func (p *Postgres) CreateGallery(ctx context.Context, galleries []Gallery) (created []Gallery, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		created, err = CreateGallery(ctx, galleries, tx)
+		return err
+	})
+
+	return created, err
+}
+
+func (p *Postgres) CreateGalleryImages(ctx context.Context, galleryId int, images []GalleryImage) error {
+	return p.write(ctx, func(tx pgx.Tx) error {
+		return CreateGalleryImages(ctx, galleryId, images, tx)
+	})
+}
+
+func (p *Postgres) DeleteGalleriesExcept(ctx context.Context, vaultId int, slugs []string, skipped []string) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteGalleriesExcept(ctx, vaultId, slugs, skipped, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) GetActors(ctx context.Context, vaultId int) ([]Actor, error) {
+	return GetActors(ctx, vaultId, p.conn())
+}
+
+func (p *Postgres) GetActorByID(ctx context.Context, actorId int) (*Actor, error) {
+	return GetActorByID(ctx, actorId, p.conn())
+}
+
+func (p *Postgres) GetActorVideos(ctx context.Context, actorId int) ([]ActorVideo, error) {
+	return GetActorVideos(ctx, actorId, p.conn())
+}
+
+func (p *Postgres) GetActorPhoto(ctx context.Context, actorId int) (string, error) {
+	return GetActorPhoto(ctx, actorId, p.conn())
+}
+
+func (p *Postgres) CreateActor(ctx context.Context, actor Actor) (actorId *int, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		actorId, err = CreateActor(ctx, actor, tx)
+		return err
+	})
+
+	return actorId, err
+}
+
+func (p *Postgres) DeleteOrphanActors(ctx context.Context, keepSlugs []string) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteOrphanActors(ctx, keepSlugs, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) DeleteOrphanTags(ctx context.Context) (deleted []string, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		deleted, err = DeleteOrphanTags(ctx, tx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (p *Postgres) GetLatestScanReport(ctx context.Context) (*ScanReport, error) {
+	return GetLatestScanReport(ctx, p.conn())
+}
+
+func (p *Postgres) CreateScanReport(ctx context.Context, report ScanReport) (reportId *int, err error) {
+	err = p.write(ctx, func(tx pgx.Tx) error {
+		reportId, err = CreateScanReport(ctx, report, tx)
+		return err
+	})
+
+	return reportId, err
+}
+
+func (p *Postgres) GetDuplicates(ctx context.Context) ([]DuplicateGroup, error) {
+	return GetDuplicates(ctx, p.conn())
+}
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Store = (*Memory)(nil)
+)
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Subtitle is a subtitle sidecar next to a video. Path is the absolute
+// path of the file and is only used to serve it.
+type Subtitle struct {
+	ID       int    `json:"id"`
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	Format   string `json:"format"`
+	Forced   bool   `json:"forced"`
+	SDH      bool   `json:"sdh"`
+	Default  bool   `json:"default"`
+	Path     string `json:"-"`
+}
+
+func GetSubtitle(ctx context.Context, subtitleId int, conn Querier) (*Subtitle, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			id,
+			language,
+			label,
+			format,
+			forced,
+			sdh,
+			is_default,
+			path
+		FROM
+			video_subtitles
+		WHERE
+			id = $1
+	`
+
+	var s Subtitle
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+		subtitleId,
+	).Scan(&s.ID, &s.Language, &s.Label, &s.Format, &s.Forced, &s.SDH, &s.Default, &s.Path)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching subtitle: %w", err)
+	}
+
+	return &s, nil
+}
@@ -3,14 +3,23 @@ package db
 import (
 	"context"
 	"fmt"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type Vault struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+
+	// ActorsScanState is saved along with the vault, so its actors
+	// folder isn't read again until it changes.
+	ActorsScanState *ScanState `json:"-"`
 }
 
-func CreateVaults(vaults []Vault) ([]Vault, error) {
+func CreateVaults(ctx context.Context, vaults []Vault, tx pgx.Tx) ([]Vault, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	// We use make() here because at this point we know the size of
 	// the vault and we won't need to reallocate memory if we were
 	// to just loop and append.
@@ -29,8 +38,8 @@ func CreateVaults(vaults []Vault) ([]Vault, error) {
         RETURNING id, name;
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	rows, err := tx.Query(
+		ctx,
 		query,
 		names,
 	)
@@ -58,13 +67,38 @@ func CreateVaults(vaults []Vault) ([]Vault, error) {
 		dbVaults = append(dbVaults, v)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]*ScanState, len(vaults))
+
+	for _, v := range vaults {
+		states[v.Name] = v.ActorsScanState
+	}
+
+	ids := make([]int, len(dbVaults))
+	actorsStates := make([]*ScanState, len(dbVaults))
+
+	for i, v := range dbVaults {
+		ids[i] = v.ID
+		actorsStates[i] = states[v.Name]
+	}
+
+	if err := saveScanStates(ctx, "vault_id", ids, actorsStates, tx); err != nil {
+		return nil, err
+	}
+
 	return dbVaults, nil
 }
 
-func GetVaults() ([]Vault, error) {
-	query := `SELECT id, name FROM vaults`
-	rows, err := db.Query(
-		context.Background(),
+func GetVaults(ctx context.Context, conn Querier) ([]Vault, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name FROM vaults ORDER BY id`
+	rows, err := conn.Query(
+		ctx,
 		query,
 	)
 
@@ -90,20 +124,69 @@ func GetVaults() ([]Vault, error) {
 	return vaults, nil
 }
 
-func GetVault(vaultId int) (*Vault, error) {
+func GetVault(ctx context.Context, vaultId int, conn Querier) (*Vault, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id, name FROM vaults WHERE id = $1`
 
 	var va Vault
 
-	err := db.QueryRow(
-		context.Background(),
+	err := conn.QueryRow(
+		ctx,
 		query,
 		vaultId,
 	).Scan(&va.ID, &va.Name)
 
 	if err != nil {
-		return nil, fmt.Errorf("error fetching video: %v", err)
+		return nil, fmt.Errorf("error fetching vault %v: %w", vaultId, err)
 	}
 
 	return &va, nil
 }
+
+func GetVaultByName(ctx context.Context, name string, conn Querier) (*Vault, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name FROM vaults WHERE name = $1`
+
+	var va Vault
+
+	err := conn.QueryRow(
+		ctx,
+		query,
+		name,
+	).Scan(&va.ID, &va.Name)
+
+	if err != nil {
+		return nil, fmt.Errorf("error fetching vault %v: %w", name, err)
+	}
+
+	return &va, nil
+}
+
+// DeleteVaultsExcept removes every vault not named in names, along with
+// everything that belongs to it, and returns the names of the removed vaults.
+func DeleteVaultsExcept(ctx context.Context, names []string, tx pgx.Tx) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `
+		DELETE FROM vaults
+		WHERE NOT (name = ANY($1::text[]))
+		RETURNING name
+	`
+
+	rows, err := tx.Query(
+		ctx,
+		query,
+		nonNil(names),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete vaults: %w", err)
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
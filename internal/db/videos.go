@@ -3,208 +3,381 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
+	"time"
 
-	"reelix-go/internal/utils"
+	"github.com/jackc/pgx/v5"
 )
 
 type Video struct {
-	ID             int      `json:"id"`
-	Title          string   `json:"title"`
-	Slug           string   `json:"slug"`
-	Studio         string   `json:"studio"`
-	Tags           []string `json:"tags"`
-	Actors         []Actor  `json:"actors"`
-	CollectionID   int      `json:"collectionId"`
-	CollectionName string   `json:"collectionName"`
-	VaultID        int      `json:"vaultId"`
-	VaultName      string   `json:"vaultName"`
+	ID             int         `json:"id"`
+	Title          string      `json:"title"`
+	SortTitle      string      `json:"sortTitle"`
+	Slug           string      `json:"slug"`
+	Studio         string      `json:"studio"`
+	Plot           string      `json:"plot"`
+	Outline        string      `json:"outline"`
+	Tagline        string      `json:"tagline"`
+	Year           int         `json:"year"`
+	Premiered      string      `json:"premiered"`
+	Runtime        int         `json:"runtime"`
+	Ratings        []Rating    `json:"ratings"`
+	UserRating     float64     `json:"userRating"`
+	MPAA           string      `json:"mpaa"`
+	Directors      []string    `json:"directors"`
+	Credits        []string    `json:"credits"`
+	Genres         []string    `json:"genres"`
+	Countries      []string    `json:"countries"`
+	SetName        string      `json:"setName"`
+	SetOverview    string      `json:"setOverview"`
+	UniqueIDs      []UniqueID  `json:"uniqueIds"`
+	Artwork        []Artwork   `json:"artwork"`
+	Media          *MediaInfo  `json:"media"`
+	Files          []VideoFile `json:"files"`
+	Subtitles      []Subtitle  `json:"subtitles"`
+	Tags           []string    `json:"tags"`
+	Actors         []Actor     `json:"actors"`
+	CollectionID   int         `json:"collectionId"`
+	CollectionName string      `json:"collectionName"`
+	VaultID        int         `json:"vaultId"`
+	VaultName      string      `json:"vaultName"`
+
+	// PosterPath is the absolute path of the poster image next to the
+	// video, which thumbnails are made from.
+	PosterPath string `json:"-"`
+
+	// ScanState is saved along with the video, so the folder isn't
+	// read again until it changes.
+	ScanState *ScanState `json:"-"`
 }
 
-func CreateVideo(video Video) error {
-	tx, err := db.Begin(context.Background())
+type Rating struct {
+	Name    string  `xml:"name,attr" json:"name"`
+	Value   float64 `xml:"value" json:"value"`
+	Votes   int     `xml:"votes" json:"votes"`
+	Max     int     `xml:"max,attr" json:"max"`
+	Default bool    `xml:"default,attr" json:"default"`
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to begin video transaction: %w", err)
-	}
+type UniqueID struct {
+	Type    string `xml:"type,attr" json:"type"`
+	Value   string `xml:",chardata" json:"value"`
+	Default bool   `xml:"default,attr" json:"default"`
+}
 
-	defer tx.Rollback(context.Background())
+// MediaInfo describes the video file itself, as read from its headers.
+type MediaInfo struct {
+	Container      string   `json:"container"`
+	Duration       float64  `json:"duration"`
+	Width          int      `json:"width"`
+	Height         int      `json:"height"`
+	VideoCodec     string   `json:"videoCodec"`
+	AudioCodecs    []string `json:"audioCodecs"`
+	AudioLanguages []string `json:"audioLanguages"`
+	Bitrate        int64    `json:"bitrate"`
+}
 
-	query := `
-		INSERT INTO videos (title, slug, studio, collection_id)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (slug) DO UPDATE
-		SET
-			title = EXCLUDED.title,
-			studio = EXCLUDED.studio
-		RETURNING id
-	`
+// VideoFile is one of the files holding a video. Multi-part videos have
+// one file per part. Path is relative to the library root, so it is also
+// the file's path on the CDN.
+type VideoFile struct {
+	ID      int       `json:"id"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Part    int       `json:"part"`
+	OSHash  string    `json:"oshash"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
 
-	var videoId int
+// Artwork is a reference to a poster, thumb or fanart image, which is
+// usually a URL rather than a file in the library.
+type Artwork struct {
+	Kind    string `json:"kind"`
+	Aspect  string `xml:"aspect,attr" json:"aspect"`
+	URL     string `xml:",chardata" json:"url"`
+	Preview string `xml:"preview,attr" json:"preview"`
+}
 
-	err = tx.QueryRow(
-		context.Background(),
-		query,
-		video.Title,
-		video.Slug,
-		video.Studio,
-		video.CollectionID,
-	).Scan(&videoId)
+// videoSelect selects videos along with their related rows, in the
+// order scanVideo reads them.
+const videoSelect = `
+	SELECT
+		v.id,
+		v.title,
+		v.sort_title,
+		v.slug,
+		v.studio,
+		v.plot,
+		v.outline,
+		v.tagline,
+		COALESCE(v.year, 0),
+		COALESCE(to_char(v.premiered, 'YYYY-MM-DD'), ''),
+		COALESCE(v.runtime, 0),
+		COALESCE(v.user_rating, 0),
+		v.mpaa,
+		v.directors,
+		v.credits,
+		v.genres,
+		v.countries,
+		v.set_name,
+		v.set_overview,
+		CASE WHEN v.container IS NULL THEN NULL ELSE json_build_object(
+			'container', v.container,
+			'duration', COALESCE(v.duration, 0),
+			'width', COALESCE(v.width, 0),
+			'height', COALESCE(v.height, 0),
+			'videoCodec', COALESCE(v.video_codec, ''),
+			'audioCodecs', COALESCE(v.audio_codecs, '{}'),
+			'audioLanguages', COALESCE(v.audio_languages, '{}'),
+			'bitrate', COALESCE(v.bitrate, 0)
+		) END AS media,
+		c.id AS collection_id,
+		c.name AS collection_name,
+		va.id AS vault_id,
+		va.name AS vault_name,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'name', r.name,
+				'value', r.value,
+				'votes', r.votes,
+				'max', r.max,
+				'default', r.is_default
+			) ORDER BY r.is_default DESC, r.name)
+			FROM video_ratings r
+			WHERE r.video_id = v.id
+		), '[]') AS ratings,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'type', u.type,
+				'value', u.value,
+				'default', u.is_default
+			) ORDER BY u.is_default DESC, u.type)
+			FROM video_unique_ids u
+			WHERE u.video_id = v.id
+		), '[]') AS unique_ids,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'kind', art.kind,
+				'aspect', art.aspect,
+				'url', art.url,
+				'preview', art.preview
+			) ORDER BY art.id)
+			FROM video_artwork art
+			WHERE art.video_id = v.id
+		), '[]') AS artwork,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'id', f.id,
+				'path', f.path,
+				'size', f.size,
+				'modTime', f.mtime,
+				'part', f.part,
+				'oshash', COALESCE(f.oshash, ''),
+				'sha256', f.sha256
+			) ORDER BY f.part, f.path)
+			FROM video_files f
+			WHERE f.video_id = v.id
+		), '[]') AS files,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'id', s.id,
+				'language', s.language,
+				'label', s.label,
+				'format', s.format,
+				'forced', s.forced,
+				'sdh', s.sdh,
+				'default', s.is_default
+			) ORDER BY s.is_default DESC, s.language, s.forced, s.sdh, s.id)
+			FROM video_subtitles s
+			WHERE s.video_id = v.id
+		), '[]') AS subtitles,
+		ARRAY(
+			SELECT t.name
+			FROM video_tags vt
+			JOIN tags t ON t.id = vt.tag_id
+			WHERE vt.video_id = v.id
+			ORDER BY t.name
+		) AS tags,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'id', a.id,
+				'name', a.name,
+				'slug', a.slug,
+				'role', vac.role,
+				'order', vac.sort_order,
+				'thumb', vac.thumb
+			) ORDER BY vac.sort_order, a.name)
+			FROM video_actors vac
+			JOIN actors a ON a.id = vac.actor_id
+			WHERE vac.video_id = v.id
+		), '[]') AS actors
+	FROM
+		videos v
+	JOIN
+		collections c ON v.collection_id = c.id
+	JOIN
+		vaults va ON c.vault_id = va.id
+`
+
+func scanVideo(row pgx.Row) (Video, error) {
+	var v Video
 
-	if err != nil {
-		return fmt.Errorf("db insert error: %w", err)
-	}
+	err := row.Scan(
+		&v.ID,
+		&v.Title,
+		&v.SortTitle,
+		&v.Slug,
+		&v.Studio,
+		&v.Plot,
+		&v.Outline,
+		&v.Tagline,
+		&v.Year,
+		&v.Premiered,
+		&v.Runtime,
+		&v.UserRating,
+		&v.MPAA,
+		&v.Directors,
+		&v.Credits,
+		&v.Genres,
+		&v.Countries,
+		&v.SetName,
+		&v.SetOverview,
+		&v.Media,
+		&v.CollectionID,
+		&v.CollectionName,
+		&v.VaultID,
+		&v.VaultName,
+		&v.Ratings,
+		&v.UniqueIDs,
+		&v.Artwork,
+		&v.Files,
+		&v.Subtitles,
+		&v.Tags,
+		&v.Actors,
+	)
 
-	log.Printf("tags: %v (video: %v)", video.Tags, video.Title)
+	return v, err
+}
 
-	for _, tag := range video.Tags {
-		tagId, err := CreateTag(tag, tx)
+func GetVideos(ctx context.Context, collectionId int, conn Querier) ([]Video, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
 
-		if err != nil {
-			return fmt.Errorf("failed to create tag %v: %w", tag, err)
-		}
+	query := videoSelect + `
+		WHERE
+			c.id = $1
+		ORDER BY
+			v.title, v.id
+	`
 
-		err = LinkVideoTag(videoId, *tagId, tx)
+	rows, err := conn.Query(
+		ctx,
+		query,
+		collectionId,
+	)
 
-		if err != nil {
-			return fmt.Errorf("failed to link tag %v to video %v: %w", tag, videoId, err)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query videos of collection %v: %w", collectionId, err)
 	}
+	defer rows.Close()
 
-	for _, actor := range video.Actors {
-		var actorId *int
-		var err error
-
-		actorId, err = GetActor(actor.Name)
+	var videos []Video
 
+	for rows.Next() {
+		v, err := scanVideo(rows)
 		if err != nil {
-			newActor := Actor{
-				Name: actor.Name,
-				Slug: utils.TitleToSnake(actor.Name),
-			}
-
-			actorId, err = CreateActor(newActor)
-
-			if err != nil {
-				return fmt.Errorf("failed to create actor %v: %w", actor.Name, err)
-			}
+			return nil, fmt.Errorf("failed to scan video of collection %v: %w", collectionId, err)
 		}
 
-		err = LinkVideoActor(videoId, *actorId, tx)
-
-		if err != nil {
-			return fmt.Errorf("failed to link actor %v to video %v: %w", actor.Name, videoId, err)
-		}
+		videos = append(videos, v)
 	}
 
-	if err := tx.Commit(context.Background()); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read videos of collection %v: %w", collectionId, err)
 	}
 
-	log.Printf("video added: %v (collection: %v)", video.Title, video.CollectionID)
-
-	return nil
+	return videos, nil
 }
 
-func GetVideos(collectionId int) ([]Video, error) {
-	query := `
-		SELECT 
-			v.id,
-			v.title,
-			v.slug,
-			v.studio,
-			c.name AS collection_name,
-			va.id AS vault_id,
-			va.name AS vault_name
-		FROM 
-			videos v
-		JOIN 
-			collections c ON v.collection_id = c.id
-		JOIN 
-			vaults va ON c.vault_id = va.id
-		WHERE 
-			c.id = $1
+func GetVideo(ctx context.Context, videoId int, conn Querier) (*Video, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := videoSelect + `
+		WHERE
+			v.id = $1
 	`
 
-	rows, err := db.Query(
-		context.Background(),
+	v, err := scanVideo(conn.QueryRow(
+		ctx,
 		query,
-		collectionId,
-	)
+		videoId,
+	))
 
 	if err != nil {
-		log.Fatal("videos query failed")
-		return nil, err
+		return nil, fmt.Errorf("error fetching video: %w", err)
 	}
-	defer rows.Close()
 
-	var videos []Video
+	return &v, nil
+}
 
-	for rows.Next() {
-		var v Video
-		if err := rows.Scan(&v.ID, &v.Title, &v.Slug, &v.Studio, &v.CollectionName, &v.VaultID, &v.VaultName); err != nil {
-			log.Fatal("videos scan failed")
-			return nil, err
-		}
+// DeleteVideosExcept removes the videos of a collection whose slug is not
+// in slugs and returns the titles of the removed videos.
+func DeleteVideosExcept(ctx context.Context, vaultId int, collectionName string, slugs []string, tx pgx.Tx) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
 
-		videos = append(videos, v)
-	}
+	query := `
+		DELETE FROM videos v
+		USING collections c
+		WHERE v.collection_id = c.id
+		AND c.vault_id = $1
+		AND c.name = $2
+		AND NOT (v.slug = ANY($3::text[]))
+		RETURNING v.title
+	`
 
-	if err := rows.Err(); err != nil {
-		log.Fatal("videos rows failed")
-		return nil, err
+	rows, err := tx.Query(
+		ctx,
+		query,
+		vaultId,
+		collectionName,
+		nonNil(slugs),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete videos from collection %v: %w", collectionName, err)
 	}
 
-	return videos, nil
+	return pgx.CollectRows(rows, pgx.RowTo[string])
 }
 
-func GetVideo(videoId int) (*Video, error) {
+// GetVideoPoster returns the path of a video's poster, or an empty string
+// when the video has none.
+func GetVideoPoster(ctx context.Context, videoId int, conn Querier) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-        SELECT 
-            v.title,
-            v.slug,
-			v.studio,
-            c.name AS collection_name,
-            va.name AS vault_name,
-			COALESCE(ARRAY_AGG(DISTINCT t.name) FILTER (WHERE t.name IS NOT NULL), '{}') AS tags,
-			COALESCE(
-				json_agg(
-					DISTINCT jsonb_build_object('name', a.name, 'slug', a.slug)
-				) FILTER (WHERE a.name IS NOT NULL),
-				'[]'
-			) AS actors
-        FROM 
-            videos v
-        JOIN 
-            collections c ON v.collection_id = c.id
-        JOIN 
-            vaults va ON c.vault_id = va.id
-		LEFT JOIN 
-    		video_tags vt ON vt.video_id = v.id
-		LEFT JOIN 
-			tags t ON t.id = vt.tag_id
-		LEFT JOIN 
-        	video_actors va2 ON va2.video_id = v.id
-		LEFT JOIN 
-        	actors a ON a.id = va2.actor_id
-        WHERE 
-            v.id = $1
-		GROUP BY 
-    		v.id, c.name, va.name
-        LIMIT 1
-    `
+		SELECT
+			COALESCE(poster_path, '')
+		FROM
+			videos
+		WHERE
+			id = $1
+	`
 
-	var v Video
+	var path string
 
-	err := db.QueryRow(
-		context.Background(),
+	err := conn.QueryRow(
+		ctx,
 		query,
 		videoId,
-	).Scan(&v.Title, &v.Slug, &v.Studio, &v.CollectionName, &v.VaultName, &v.Tags, &v.Actors)
+	).Scan(&path)
 
 	if err != nil {
-		return nil, fmt.Errorf("error fetching video: %v", err)
+		return "", fmt.Errorf("error fetching video poster: %w", err)
 	}
 
-	return &v, nil
+	return path, nil
 }
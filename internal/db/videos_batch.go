@@ -0,0 +1,639 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"reelix-go/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// videoStagingColumns are the columns videos are copied into before being
+// upserted, in the order videoStagingRow returns them.
+var videoStagingColumns = []string{
+	"title", "slug", "studio", "sort_title", "plot", "outline", "tagline",
+	"year", "premiered", "runtime", "user_rating", "mpaa",
+	"directors", "credits", "genres", "countries",
+	"set_name", "set_overview",
+	"container", "duration", "width", "height", "video_codec",
+	"audio_codecs", "audio_languages", "bitrate",
+	"collection_id", "poster_path",
+}
+
+// CreateVideos writes a batch of videos and everything that belongs to
+// them as part of tx, in a handful of statements rather than a few per
+// video. Actors it credits that don't exist yet are created along the way.
+func CreateVideos(ctx context.Context, videos []Video, tx pgx.Tx) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if len(videos) == 0 {
+		return nil
+	}
+
+	videos = uniqueByFolder(videos)
+
+	videoIds, err := upsertVideos(ctx, videos, tx)
+
+	if err != nil {
+		return err
+	}
+
+	// Everything else refers to the videos by ID, so it can be sent
+	// in a single round trip.
+
+	batch := &pgx.Batch{}
+
+	queueVideoRatings(batch, videos, videoIds)
+	queueVideoUniqueIDs(batch, videos, videoIds)
+	queueVideoArtwork(batch, videos, videoIds)
+	queueVideoFiles(batch, videos, videoIds)
+	queueVideoSubtitles(batch, videos, videoIds)
+	queueVideoTags(batch, videos, videoIds)
+	queueVideoActors(batch, videos, videoIds)
+	queueVideoScanStates(batch, videos, videoIds)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to write videos of collection %v: %w", videos[0].CollectionID, err)
+	}
+
+	log.Printf("videos added: %v (collection: %v)", len(videos), videos[0].CollectionID)
+
+	return nil
+}
+
+// videoKey is what identifies a video: the folder it was read from is
+// unique within its collection, but may be in other collections too.
+type videoKey struct {
+	collectionId int
+	slug         string
+}
+
+// uniqueByFolder drops all but the last of videos sharing a collection and
+// slug, as a single upsert can't touch the same row twice.
+func uniqueByFolder(videos []Video) []Video {
+	last := make(map[videoKey]int, len(videos))
+
+	for i, v := range videos {
+		last[videoKey{v.CollectionID, v.Slug}] = i
+	}
+
+	if len(last) == len(videos) {
+		return videos
+	}
+
+	unique := make([]Video, 0, len(last))
+
+	for i, v := range videos {
+		if last[videoKey{v.CollectionID, v.Slug}] == i {
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
+
+// upsertVideos copies the videos into a staging table and upserts them
+// from there, as their array columns can't be passed through UNNEST. It
+// returns the ID of every video in the order given.
+func upsertVideos(ctx context.Context, videos []Video, tx pgx.Tx) ([]int, error) {
+	stagingQuery := `
+		CREATE TEMP TABLE IF NOT EXISTS video_staging (
+			title           TEXT,
+			slug            TEXT,
+			studio          TEXT,
+			sort_title      TEXT,
+			plot            TEXT,
+			outline         TEXT,
+			tagline         TEXT,
+			year            INTEGER,
+			premiered       TEXT,
+			runtime         INTEGER,
+			user_rating     DOUBLE PRECISION,
+			mpaa            TEXT,
+			directors       TEXT[],
+			credits         TEXT[],
+			genres          TEXT[],
+			countries       TEXT[],
+			set_name        TEXT,
+			set_overview    TEXT,
+			container       TEXT,
+			duration        DOUBLE PRECISION,
+			width           INTEGER,
+			height          INTEGER,
+			video_codec     TEXT,
+			audio_codecs    TEXT[],
+			audio_languages TEXT[],
+			bitrate         BIGINT,
+			collection_id   INTEGER,
+			poster_path     TEXT
+		) ON COMMIT DROP
+	`
+
+	_, err := tx.Exec(ctx, stagingQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create video staging table: %w", err)
+	}
+
+	// The table outlives a call when a transaction writes several
+	// batches.
+
+	_, err = tx.Exec(ctx, `TRUNCATE video_staging`)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear video staging table: %w", err)
+	}
+
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"video_staging"},
+		videoStagingColumns,
+		pgx.CopyFromSlice(len(videos), func(i int) ([]any, error) {
+			return videoStagingRow(videos[i]), nil
+		}),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy videos: %w", err)
+	}
+
+	query := `
+		INSERT INTO videos (
+			title, slug, studio, sort_title, plot, outline, tagline,
+			year, premiered, runtime, user_rating, mpaa,
+			directors, credits, genres, countries,
+			set_name, set_overview,
+			container, duration, width, height, video_codec,
+			audio_codecs, audio_languages, bitrate,
+			collection_id, poster_path
+		)
+		SELECT
+			title, slug, studio, sort_title, plot, outline, tagline,
+			NULLIF(year, 0), NULLIF(premiered, '')::date, NULLIF(runtime, 0), NULLIF(user_rating, 0), mpaa,
+			directors, credits, genres, countries,
+			set_name, set_overview,
+			container, duration, width, height, video_codec,
+			audio_codecs, audio_languages, bitrate,
+			collection_id, poster_path
+		FROM video_staging
+		ON CONFLICT (collection_id, slug) DO UPDATE
+		SET
+			title = EXCLUDED.title,
+			studio = EXCLUDED.studio,
+			sort_title = EXCLUDED.sort_title,
+			plot = EXCLUDED.plot,
+			outline = EXCLUDED.outline,
+			tagline = EXCLUDED.tagline,
+			year = EXCLUDED.year,
+			premiered = EXCLUDED.premiered,
+			runtime = EXCLUDED.runtime,
+			user_rating = EXCLUDED.user_rating,
+			mpaa = EXCLUDED.mpaa,
+			directors = EXCLUDED.directors,
+			credits = EXCLUDED.credits,
+			genres = EXCLUDED.genres,
+			countries = EXCLUDED.countries,
+			set_name = EXCLUDED.set_name,
+			set_overview = EXCLUDED.set_overview,
+			container = EXCLUDED.container,
+			duration = EXCLUDED.duration,
+			width = EXCLUDED.width,
+			height = EXCLUDED.height,
+			video_codec = EXCLUDED.video_codec,
+			audio_codecs = EXCLUDED.audio_codecs,
+			audio_languages = EXCLUDED.audio_languages,
+			bitrate = EXCLUDED.bitrate,
+			poster_path = EXCLUDED.poster_path
+		RETURNING id, collection_id, slug
+	`
+
+	rows, err := tx.Query(ctx, query)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert videos: %w", err)
+	}
+
+	defer rows.Close()
+
+	ids := make(map[videoKey]int, len(videos))
+
+	for rows.Next() {
+		var id int
+		var key videoKey
+
+		if err := rows.Scan(&id, &key.collectionId, &key.slug); err != nil {
+			return nil, err
+		}
+
+		ids[key] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to upsert videos: %w", err)
+	}
+
+	videoIds := make([]int, len(videos))
+
+	for i, v := range videos {
+		videoIds[i] = ids[videoKey{v.CollectionID, v.Slug}]
+	}
+
+	return videoIds, nil
+}
+
+func videoStagingRow(video Video) []any {
+	// Videos without a probed file store NULL for every media column.
+	media := MediaInfo{}
+	var duration *float64
+	var width, height *int
+	var bitrate *int64
+	var audioCodecs, audioLanguages []string
+
+	if video.Media != nil {
+		media = *video.Media
+		duration = &media.Duration
+		width = &media.Width
+		height = &media.Height
+		bitrate = &media.Bitrate
+		audioCodecs = nonNil(media.AudioCodecs)
+		audioLanguages = nonNil(media.AudioLanguages)
+	}
+
+	return []any{
+		video.Title,
+		video.Slug,
+		video.Studio,
+		video.SortTitle,
+		video.Plot,
+		video.Outline,
+		video.Tagline,
+		video.Year,
+		video.Premiered,
+		video.Runtime,
+		video.UserRating,
+		video.MPAA,
+		nonNil(video.Directors),
+		nonNil(video.Credits),
+		nonNil(video.Genres),
+		nonNil(video.Countries),
+		video.SetName,
+		video.SetOverview,
+		nullIfEmpty(media.Container),
+		duration,
+		width,
+		height,
+		nullIfEmpty(media.VideoCodec),
+		audioCodecs,
+		audioLanguages,
+		bitrate,
+		video.CollectionID,
+		nullIfEmpty(video.PosterPath),
+	}
+}
+
+func queueVideoRatings(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids, votes, maxes []int
+	var names []string
+	var values []float64
+	var defaults []bool
+
+	for i, v := range videos {
+		for _, r := range v.Ratings {
+			ids = append(ids, videoIds[i])
+			names = append(names, r.Name)
+			values = append(values, r.Value)
+			votes = append(votes, r.Votes)
+			maxes = append(maxes, r.Max)
+			defaults = append(defaults, r.Default)
+		}
+	}
+
+	batch.Queue(`DELETE FROM video_ratings WHERE video_id = ANY($1::int[])`, videoIds)
+
+	query := `
+		INSERT INTO video_ratings (video_id, name, value, votes, max, is_default)
+		SELECT *
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::float8[],
+			$4::int[],
+			$5::int[],
+			$6::bool[]
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	batch.Queue(query, ids, names, values, votes, maxes, defaults)
+}
+
+func queueVideoUniqueIDs(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids []int
+	var types, values []string
+	var defaults []bool
+
+	for i, v := range videos {
+		for _, id := range v.UniqueIDs {
+			ids = append(ids, videoIds[i])
+			types = append(types, id.Type)
+			values = append(values, id.Value)
+			defaults = append(defaults, id.Default)
+		}
+	}
+
+	batch.Queue(`DELETE FROM video_unique_ids WHERE video_id = ANY($1::int[])`, videoIds)
+
+	query := `
+		INSERT INTO video_unique_ids (video_id, type, value, is_default)
+		SELECT *
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::text[],
+			$4::bool[]
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	batch.Queue(query, ids, types, values, defaults)
+}
+
+func queueVideoArtwork(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids []int
+	var kinds, aspects, urls, previews []string
+
+	for i, v := range videos {
+		for _, art := range v.Artwork {
+			ids = append(ids, videoIds[i])
+			kinds = append(kinds, art.Kind)
+			aspects = append(aspects, art.Aspect)
+			urls = append(urls, art.URL)
+			previews = append(previews, art.Preview)
+		}
+	}
+
+	batch.Queue(`DELETE FROM video_artwork WHERE video_id = ANY($1::int[])`, videoIds)
+
+	query := `
+		INSERT INTO video_artwork (video_id, kind, aspect, url, preview)
+		SELECT *
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::text[],
+			$4::text[],
+			$5::text[]
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	batch.Queue(query, ids, kinds, aspects, urls, previews)
+}
+
+// queueVideoFiles updates the files of the videos in place, so a file
+// keeps its ID for as long as it stays at the same path.
+func queueVideoFiles(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids, parts []int
+	var paths, oshashes, sha256s []string
+	var sizes []int64
+	var mtimes []time.Time
+
+	for i, v := range videos {
+		for _, f := range v.Files {
+			ids = append(ids, videoIds[i])
+			paths = append(paths, f.Path)
+			sizes = append(sizes, f.Size)
+			mtimes = append(mtimes, f.ModTime)
+			parts = append(parts, f.Part)
+			oshashes = append(oshashes, f.OSHash)
+			sha256s = append(sha256s, f.SHA256)
+		}
+	}
+
+	deleteQuery := `
+		DELETE FROM video_files f
+		WHERE f.video_id = ANY($1::int[])
+		AND NOT EXISTS (
+			SELECT 1
+			FROM UNNEST($2::int[], $3::text[]) AS t(video_id, path)
+			WHERE t.video_id = f.video_id
+			AND t.path = f.path
+		)
+	`
+
+	batch.Queue(deleteQuery, videoIds, ids, paths)
+
+	query := `
+		INSERT INTO video_files (video_id, path, size, mtime, part, oshash, sha256)
+		SELECT
+			t.video_id,
+			t.path,
+			t.size,
+			t.mtime,
+			t.part,
+			NULLIF(t.oshash, ''),
+			NULLIF(t.sha256, '')
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::bigint[],
+			$4::timestamptz[],
+			$5::int[],
+			$6::text[],
+			$7::text[]
+		) AS t(video_id, path, size, mtime, part, oshash, sha256)
+		ON CONFLICT (video_id, path) DO UPDATE SET
+			size = EXCLUDED.size,
+			mtime = EXCLUDED.mtime,
+			part = EXCLUDED.part,
+			oshash = EXCLUDED.oshash,
+			sha256 = EXCLUDED.sha256
+	`
+
+	batch.Queue(query, ids, paths, sizes, mtimes, parts, oshashes, sha256s)
+}
+
+// queueVideoSubtitles updates the subtitles of the videos in place, so a
+// track keeps its ID for as long as the file stays at the same path.
+func queueVideoSubtitles(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids []int
+	var paths, languages, labels, formats []string
+	var forced, sdh, defaults []bool
+
+	for i, v := range videos {
+		for _, s := range v.Subtitles {
+			ids = append(ids, videoIds[i])
+			paths = append(paths, s.Path)
+			languages = append(languages, s.Language)
+			labels = append(labels, s.Label)
+			formats = append(formats, s.Format)
+			forced = append(forced, s.Forced)
+			sdh = append(sdh, s.SDH)
+			defaults = append(defaults, s.Default)
+		}
+	}
+
+	deleteQuery := `
+		DELETE FROM video_subtitles s
+		WHERE s.video_id = ANY($1::int[])
+		AND NOT EXISTS (
+			SELECT 1
+			FROM UNNEST($2::int[], $3::text[]) AS t(video_id, path)
+			WHERE t.video_id = s.video_id
+			AND t.path = s.path
+		)
+	`
+
+	batch.Queue(deleteQuery, videoIds, ids, paths)
+
+	query := `
+		INSERT INTO video_subtitles (video_id, path, language, label, format, forced, sdh, is_default)
+		SELECT *
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::text[],
+			$4::text[],
+			$5::text[],
+			$6::bool[],
+			$7::bool[],
+			$8::bool[]
+		)
+		ON CONFLICT (video_id, path) DO UPDATE SET
+			language = EXCLUDED.language,
+			label = EXCLUDED.label,
+			format = EXCLUDED.format,
+			forced = EXCLUDED.forced,
+			sdh = EXCLUDED.sdh,
+			is_default = EXCLUDED.is_default
+	`
+
+	batch.Queue(query, ids, paths, languages, labels, formats, forced, sdh, defaults)
+}
+
+// queueVideoTags links the videos to exactly the tags they list, creating
+// the tags that don't exist yet. Tags left without videos are pruned later.
+func queueVideoTags(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids []int
+	var names []string
+
+	for i, v := range videos {
+		for _, tag := range v.Tags {
+			ids = append(ids, videoIds[i])
+			names = append(names, tag)
+		}
+	}
+
+	tagQuery := `
+		INSERT INTO tags (name)
+		SELECT DISTINCT name
+		FROM UNNEST($1::text[]) AS t(name)
+		ON CONFLICT (name) DO NOTHING
+	`
+
+	batch.Queue(tagQuery, names)
+
+	staleQuery := `
+		DELETE FROM video_tags vt
+		WHERE vt.video_id = ANY($1::int[])
+		AND NOT EXISTS (
+			SELECT 1
+			FROM UNNEST($2::int[], $3::text[]) AS t(video_id, name)
+			JOIN tags ON tags.name = t.name
+			WHERE t.video_id = vt.video_id
+			AND tags.id = vt.tag_id
+		)
+	`
+
+	batch.Queue(staleQuery, videoIds, ids, names)
+
+	linkQuery := `
+		INSERT INTO video_tags (video_id, tag_id)
+		SELECT t.video_id, tags.id
+		FROM UNNEST($1::int[], $2::text[]) AS t(video_id, name)
+		JOIN tags ON tags.name = t.name
+		ON CONFLICT DO NOTHING
+	`
+
+	batch.Queue(linkQuery, ids, names)
+}
+
+// queueVideoActors links the videos to exactly the actors they credit,
+// creating the actors that don't exist yet. Actors are told apart by the
+// slug of their name, and a credit never renames an existing actor.
+func queueVideoActors(batch *pgx.Batch, videos []Video, videoIds []int) {
+	var ids, orders []int
+	var names, slugs, roles, thumbs []string
+
+	for i, v := range videos {
+		for _, a := range v.Actors {
+			ids = append(ids, videoIds[i])
+			names = append(names, a.Name)
+			slugs = append(slugs, utils.TitleToSnake(a.Name))
+			roles = append(roles, a.Role)
+			orders = append(orders, a.Order)
+			thumbs = append(thumbs, a.Thumb)
+		}
+	}
+
+	actorQuery := `
+		INSERT INTO actors (name, slug)
+		SELECT DISTINCT ON (t.slug) t.name, t.slug
+		FROM UNNEST($1::text[], $2::text[]) AS t(name, slug)
+		ON CONFLICT (slug) DO NOTHING
+	`
+
+	batch.Queue(actorQuery, names, slugs)
+
+	staleQuery := `
+		DELETE FROM video_actors va
+		WHERE va.video_id = ANY($1::int[])
+		AND NOT EXISTS (
+			SELECT 1
+			FROM UNNEST($2::int[], $3::text[]) AS t(video_id, slug)
+			JOIN actors a ON a.slug = t.slug
+			WHERE t.video_id = va.video_id
+			AND a.id = va.actor_id
+		)
+	`
+
+	batch.Queue(staleQuery, videoIds, ids, slugs)
+
+	// An actor listed twice in the same video is linked once, with the
+	// part it is listed with last.
+
+	linkQuery := `
+		INSERT INTO video_actors (video_id, actor_id, role, sort_order, thumb)
+		SELECT DISTINCT ON (t.video_id, a.id)
+			t.video_id, a.id, t.role, t.sort_order, t.thumb
+		FROM UNNEST(
+			$1::int[],
+			$2::text[],
+			$3::text[],
+			$4::int[],
+			$5::text[]
+		) WITH ORDINALITY AS t(video_id, slug, role, sort_order, thumb, n)
+		JOIN actors a ON a.slug = t.slug
+		ORDER BY t.video_id, a.id, t.n DESC
+		ON CONFLICT (video_id, actor_id) DO UPDATE SET
+			role = EXCLUDED.role,
+			sort_order = EXCLUDED.sort_order,
+			thumb = EXCLUDED.thumb
+	`
+
+	batch.Queue(linkQuery, ids, slugs, roles, orders, thumbs)
+}
+
+func queueVideoScanStates(batch *pgx.Batch, videos []Video, videoIds []int) {
+	states := make([]*ScanState, len(videos))
+
+	for i, v := range videos {
+		states[i] = v.ScanState
+	}
+
+	queueScanStates(batch, "video_id", videoIds, states)
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// connectBench connects to the database in TEST_DATABASE_URL and brings
+// its schema up to date, and skips the benchmark when it isn't set.
+func connectBench(b *testing.B) *pgxpool.Pool {
+	b.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+
+	if url == "" {
+		b.Skip("TEST_DATABASE_URL not set")
+	}
+
+	pool, err := Connect(context.Background(), url)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(pool.Close)
+
+	if _, err := MigrateUp(context.Background(), pool); err != nil {
+		b.Fatal(err)
+	}
+
+	return pool
+}
+
+// benchVideos makes a collection's worth of videos that share a pool of
+// tags and actors, the way the videos of a studio usually do.
+func benchVideos(count int) []Video {
+	videos := make([]Video, count)
+
+	for i := range videos {
+		videos[i] = Video{
+			Title:     fmt.Sprintf("Video %d", i),
+			Slug:      fmt.Sprintf("bench_video_%d", i),
+			Studio:    "Bench Studio",
+			Year:      2000 + i%25,
+			Premiered: "2020-01-02",
+			Genres:    []string{"Drama", "Comedy"},
+			Ratings:   []Rating{{Name: "imdb", Value: 7.5, Votes: 100, Max: 10, Default: true}},
+			UniqueIDs: []UniqueID{{Type: "imdb", Value: fmt.Sprintf("tt%07d", i), Default: true}},
+			Files: []VideoFile{{
+				Path:    fmt.Sprintf("vaults/bench/videos/bench/video_%d/video_%d.mp4", i, i),
+				Size:    int64(i) * 1024,
+				ModTime: time.Unix(1700000000, 0),
+				Part:    1,
+			}},
+			Tags: []string{
+				fmt.Sprintf("bench tag %d", i%20),
+				fmt.Sprintf("bench tag %d", (i+1)%20),
+				fmt.Sprintf("bench tag %d", (i+2)%20),
+			},
+			Actors: []Actor{
+				{Name: fmt.Sprintf("Bench Actor %d", i%50), Role: "Lead", Order: 0},
+				{Name: fmt.Sprintf("Bench Actor %d", (i+7)%50), Role: "Support", Order: 1},
+			},
+			ScanState: &ScanState{
+				Path:         fmt.Sprintf("/bench/video_%d", i),
+				ModTime:      time.Unix(1700000000, 0),
+				Size:         int64(i) * 1024,
+				MetadataHash: "bench",
+			},
+		}
+	}
+
+	return videos
+}
+
+// benchCollection creates a collection to write the videos into as part
+// of tx and points the videos at it.
+func benchCollection(b *testing.B, videos []Video, tx pgx.Tx) {
+	b.Helper()
+
+	vaults, err := CreateVaults(context.Background(), []Vault{{Name: "bench"}}, tx)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	collections, err := CreateCollections(context.Background(), []Collection{{
+		Name:    "bench",
+		Slug:    "bench",
+		VaultID: vaults[0].ID,
+	}}, tx)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := range videos {
+		videos[i].CollectionID = collections[0].ID
+	}
+}
+
+// benchmarkSync writes a collection of videos with write in a transaction
+// that is rolled back afterwards, so every iteration starts out the same.
+func benchmarkSync(b *testing.B, write func(videos []Video, tx pgx.Tx) error) {
+	pool := connectBench(b)
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("videos=%d", count), func(b *testing.B) {
+			videos := benchVideos(count)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+
+				tx, err := pool.Begin(context.Background())
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				benchCollection(b, videos, tx)
+
+				b.StartTimer()
+
+				if err := write(videos, tx); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+
+				if err := tx.Rollback(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkCreateVideosOneByOne writes every video in a batch of its own,
+// which shows what writing a whole collection in one batch saves. Each
+// video still takes a handful of round trips, not the one or more per
+// tag, actor and file that syncs took before writes were batched.
+func BenchmarkCreateVideosOneByOne(b *testing.B) {
+	benchmarkSync(b, func(videos []Video, tx pgx.Tx) error {
+		for _, v := range videos {
+			if err := CreateVideos(context.Background(), []Video{v}, tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func BenchmarkCreateVideos(b *testing.B) {
+	benchmarkSync(b, func(videos []Video, tx pgx.Tx) error {
+		return CreateVideos(context.Background(), videos, tx)
+	})
+}
@@ -0,0 +1,237 @@
+package scanner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"reelix-go/internal/db"
+	"reelix-go/internal/utils"
+)
+
+// PersonMetadata follows the Kodi person .nfo schema. The tags Jellyfin
+// and Emby write for the same fields are read as well.
+type PersonMetadata struct {
+	Name         string        `xml:"name"`
+	Biography    string        `xml:"biography"`
+	Plot         string        `xml:"plot"`
+	Birthdate    string        `xml:"birthdate"`
+	Premiered    string        `xml:"premiered"`
+	Birthplace   string        `xml:"birthplace"`
+	PlaceOfBirth string        `xml:"placeofbirth"`
+	Aliases      []string      `xml:"alias"`
+	UniqueIDs    []db.UniqueID `xml:"uniqueid"`
+}
+
+// actorFiles are the photo and .nfo an actor is made of, either of which
+// may be missing.
+type actorFiles struct {
+	slug  string
+	photo string
+	nfo   string
+}
+
+// listActors lists the actors in the actors folder of a vault. An actor is
+// a photo, an .nfo or both, sharing the actor's slug as their name.
+func listActors(actorsPath string, ig *ignorer) ([]actorFiles, error) {
+	entries, err := os.ReadDir(actorsPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read actors: %w", err)
+	}
+
+	var slugs []string
+	photos := map[string]string{}
+	nfos := map[string]string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || ig.skip(actorsPath, entry) {
+			continue
+		}
+
+		name := entry.Name()
+		slug := strings.TrimSuffix(name, filepath.Ext(name))
+		_, seen := photos[slug]
+
+		if _, ok := nfos[slug]; ok {
+			seen = true
+		}
+
+		switch {
+		case isImage(name):
+			// Entries are sorted, so the first photo of an
+			// actor wins when there are several.
+			if _, ok := photos[slug]; ok {
+				continue
+			}
+
+			photos[slug] = name
+
+		case strings.EqualFold(filepath.Ext(name), ".nfo"):
+			nfos[slug] = name
+
+		default:
+			continue
+		}
+
+		if !seen {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	actors := make([]actorFiles, 0, len(slugs))
+
+	for _, slug := range slugs {
+		actors = append(actors, actorFiles{slug: slug, photo: photos[slug], nfo: nfos[slug]})
+	}
+
+	return actors, nil
+}
+
+// actors reads the actors folder of a vault.
+func (s *scanRun) actors(actorsPath string) ([]db.Actor, error) {
+	files, err := listActors(actorsPath, s.ignore)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var actors []db.Actor
+
+	for _, f := range files {
+		actors = append(actors, s.readActor(actorsPath, f))
+	}
+
+	return actors, nil
+}
+
+// vaultActors reads the actors folder of a vault into state, or only lists
+// the actors in it when it hasn't changed since it was last read.
+func (s *scanRun) vaultActors(state *VaultState, actorsPath string) error {
+	// The state is taken before reading, so anything that changes
+	// while we read is picked up by the next scan. A folder that
+	// can't be fingerprinted is simply read, which reports why.
+	var actorsState *db.ScanState
+
+	if s.skip {
+		actorsState, _ = s.actorsState(actorsPath)
+	}
+
+	if isUnchanged(s.scanStates(actorsPath), actorsState) {
+		files, err := listActors(actorsPath, s.ignore)
+
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			state.unchangedActors = append(state.unchangedActors, f.slug)
+		}
+
+		log.Printf("skipped %v unchanged actors (vault: %v)", len(files), state.Vault.Name)
+
+		return nil
+	}
+
+	actors, err := s.actors(actorsPath)
+
+	if err != nil {
+		return err
+	}
+
+	state.Actors = actors
+	state.Vault.ActorsScanState = actorsState
+
+	return nil
+}
+
+// readActor builds an actor from their photo and .nfo. An .nfo that can't
+// be read leaves just the photo.
+func (s *scanRun) readActor(actorsPath string, files actorFiles) db.Actor {
+	actor := db.Actor{
+		Name: utils.SnakeToTitle(files.slug),
+		Slug: files.slug,
+	}
+
+	if files.photo != "" {
+		actor.PhotoPath = filepath.Join(actorsPath, files.photo)
+	}
+
+	if files.nfo == "" {
+		return actor
+	}
+
+	nfoPath := filepath.Join(actorsPath, files.nfo)
+	metadata, err := parsePersonNfoFile(nfoPath)
+
+	if err != nil {
+		s.report.warn(nfoPath, "failed to parse actor metadata: %v", err)
+		return actor
+	}
+
+	metadata.apply(&actor)
+
+	if actor.Birthdate != "" {
+		if _, err := time.Parse(time.DateOnly, actor.Birthdate); err != nil {
+			s.report.warn(nfoPath, "ignoring invalid birthdate %q", actor.Birthdate)
+			actor.Birthdate = ""
+		}
+	}
+
+	return actor
+}
+
+func parsePersonNfoFile(nfoPath string) (PersonMetadata, error) {
+	data, err := os.ReadFile(nfoPath)
+	if err != nil {
+		return PersonMetadata{}, err
+	}
+
+	var metadata PersonMetadata
+	err = xml.Unmarshal(data, &metadata)
+	if err != nil {
+		return PersonMetadata{}, err
+	}
+
+	return metadata, nil
+}
+
+// apply copies the metadata onto an actor. The name from the .nfo is
+// preferred, as it is the one videos credit the actor under.
+func (m PersonMetadata) apply(actor *db.Actor) {
+	if name := strings.TrimSpace(m.Name); name != "" {
+		actor.Name = name
+	}
+
+	actor.Biography = firstNonEmpty(m.Biography, m.Plot)
+	actor.Birthdate = firstNonEmpty(m.Birthdate, m.Premiered)
+	actor.Birthplace = firstNonEmpty(m.Birthplace, m.PlaceOfBirth)
+
+	for _, alias := range m.Aliases {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			actor.Aliases = append(actor.Aliases, alias)
+		}
+	}
+
+	for _, id := range m.UniqueIDs {
+		id.Value = strings.TrimSpace(id.Value)
+
+		if id.Value != "" {
+			actor.UniqueIDs = append(actor.UniqueIDs, id)
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"reelix-go/internal/db"
+	"reelix-go/internal/utils"
+)
+
+// archiveExtensions are the files in pictures/ that are read as galleries.
+var archiveExtensions = map[string]bool{
+	".cbz": true,
+	".zip": true,
+}
+
+// maxArchiveImageSize caps how much of an archive entry is read into
+// memory, which keeps a corrupt or malicious archive from exhausting it.
+const maxArchiveImageSize = 256 << 20
+
+func isArchive(fileName string) bool {
+	return archiveExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// archive indexes the images of a zip or cbz archive without extracting
+// it. Entries are named by their path inside the archive.
+func (s *scanRun) archive(picturePath string, fileName string) (db.Gallery, error) {
+	archivePath := filepath.Join(picturePath, fileName)
+	zr, err := zip.OpenReader(archivePath)
+
+	if err != nil {
+		return db.Gallery{}, err
+	}
+
+	defer zr.Close()
+
+	var images []db.GalleryImage
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isImage(f.Name) || isArchiveJunk(f.Name) {
+			continue
+		}
+
+		entryPath := archivePath + "/" + f.Name
+
+		if f.UncompressedSize64 > maxArchiveImageSize {
+			s.report.warn(entryPath, "skipping image larger than %d bytes", maxArchiveImageSize)
+			continue
+		}
+
+		data, err := readArchiveEntry(f)
+
+		if err != nil {
+			s.report.warn(entryPath, "failed to read image: %v", err)
+			continue
+		}
+
+		image := db.GalleryImage{
+			Filename: f.Name,
+			Size:     int64(len(data)),
+			Format:   imageFormat(f.Name),
+		}
+
+		s.decodeImage(&image, bytes.NewReader(data), entryPath)
+
+		image.OSHash, image.SHA256 = s.hashData(entryPath, data)
+
+		images = append(images, image)
+	}
+
+	sortImages(images)
+
+	// The slug keeps the extension, so an archive never clashes with
+	// a folder of the same name.
+	return db.Gallery{
+		Title:      utils.SnakeToTitle(strings.TrimSuffix(fileName, filepath.Ext(fileName))),
+		Slug:       fileName,
+		Path:       archivePath,
+		Archive:    true,
+		ImageCount: len(images),
+		Images:     images,
+	}, nil
+}
+
+func readArchiveEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxArchiveImageSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxArchiveImageSize {
+		return nil, fmt.Errorf("image larger than %d bytes", maxArchiveImageSize)
+	}
+
+	return data, nil
+}
+
+// isArchiveJunk reports entries that archivers on macOS add next to the
+// real files.
+func isArchiveJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._")
+}
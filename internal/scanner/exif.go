@@ -0,0 +1,387 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"reelix-go/internal/db"
+)
+
+var errNoEXIF = errors.New("no exif data")
+
+// EXIF tags, see https://exiftool.org/TagNames/EXIF.html
+const (
+	exifMake             = 0x010F
+	exifModel            = 0x0110
+	exifOrientation      = 0x0112
+	exifDateTime         = 0x0132
+	exifIFDPointer       = 0x8769
+	exifGPSPointer       = 0x8825
+	exifExposureTime     = 0x829A
+	exifFNumber          = 0x829D
+	exifISO              = 0x8827
+	exifDateTimeOriginal = 0x9003
+	exifOffsetTimeOrig   = 0x9011
+	exifFocalLength      = 0x920A
+	exifLensModel        = 0xA434
+
+	exifGPSLatitudeRef  = 0x0001
+	exifGPSLatitude     = 0x0002
+	exifGPSLongitudeRef = 0x0003
+	exifGPSLongitude    = 0x0004
+	exifGPSAltitudeRef  = 0x0005
+	exifGPSAltitude     = 0x0006
+)
+
+const (
+	exifDateLayout       = "2006:01:02 15:04:05"
+	exifDateOffsetLayout = "2006:01:02 15:04:05-07:00"
+
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerAPP1 = 0xE1
+)
+
+// tiffTypeSizes are the sizes in bytes of the TIFF field types.
+var tiffTypeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+type tiffEntry struct {
+	fieldType uint16
+	count     uint32
+	value     []byte
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// decodeEXIF reads the EXIF metadata of a JPEG stream. Only the segments
+// before the image data are read.
+func decodeEXIF(jpeg io.Reader) (*db.ImageEXIF, error) {
+	r := bufio.NewReader(jpeg)
+
+	var soi [2]byte
+
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, errNoEXIF
+	}
+
+	for {
+		marker, err := jpegMarker(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			return nil, errNoEXIF
+		}
+
+		var length [2]byte
+
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return nil, err
+		}
+
+		size := int(binary.BigEndian.Uint16(length[:])) - 2
+
+		if size < 0 {
+			return nil, fmt.Errorf("invalid jpeg segment length")
+		}
+
+		if marker != jpegMarkerAPP1 {
+			if _, err := r.Discard(size); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		segment := make([]byte, size)
+
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+
+		// APP1 also holds XMP, which we skip.
+		if !strings.HasPrefix(string(segment), "Exif\x00\x00") {
+			continue
+		}
+
+		return parseTIFF(segment[6:])
+	}
+}
+
+// jpegMarker reads the next marker, skipping the fill bytes that may
+// come before it.
+func jpegMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if b != 0xFF {
+		return 0, fmt.Errorf("invalid jpeg marker")
+	}
+
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+// parseTIFF reads the TIFF structure inside an EXIF segment: IFD0 with
+// the camera, and the EXIF and GPS sub-IFDs it points to.
+func parseTIFF(data []byte) (*db.ImageEXIF, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif header too short")
+	}
+
+	t := tiff{data: data}
+
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid exif byte order")
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(data[4:8]))
+
+	if err != nil {
+		return nil, err
+	}
+
+	exif := &db.ImageEXIF{
+		Make:        t.string(ifd0[exifMake]),
+		Model:       t.string(ifd0[exifModel]),
+		Orientation: int(t.uint(ifd0[exifOrientation])),
+	}
+
+	date := t.string(ifd0[exifDateTime])
+	offset := ""
+
+	if e, ok := ifd0[exifIFDPointer]; ok {
+		sub, err := t.ifd(t.uint(e))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if original := t.string(sub[exifDateTimeOriginal]); original != "" {
+			date = original
+			offset = t.string(sub[exifOffsetTimeOrig])
+		}
+
+		exif.ExposureTime = exposureTime(t.rationals(sub[exifExposureTime]))
+		exif.FNumber = first(t.rationals(sub[exifFNumber]))
+		exif.ISO = int(t.uint(sub[exifISO]))
+		exif.FocalLength = first(t.rationals(sub[exifFocalLength]))
+		exif.Lens = t.string(sub[exifLensModel])
+	}
+
+	exif.TakenAt = exifTime(date, offset)
+
+	if e, ok := ifd0[exifGPSPointer]; ok {
+		gps, err := t.ifd(t.uint(e))
+
+		if err != nil {
+			return nil, err
+		}
+
+		exif.Latitude = gpsCoordinate(t.rationals(gps[exifGPSLatitude]), t.string(gps[exifGPSLatitudeRef]), "S")
+		exif.Longitude = gpsCoordinate(t.rationals(gps[exifGPSLongitude]), t.string(gps[exifGPSLongitudeRef]), "W")
+
+		if altitude := t.rationals(gps[exifGPSAltitude]); len(altitude) > 0 {
+			value := altitude[0]
+
+			// A reference of 1 means below sea level.
+			if t.uint(gps[exifGPSAltitudeRef]) == 1 {
+				value = -value
+			}
+
+			exif.Altitude = &value
+		}
+	}
+
+	return exif, nil
+}
+
+// ifd reads the entries of the image file directory at offset.
+func (t tiff) ifd(offset uint32) (map[uint16]tiffEntry, error) {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil, fmt.Errorf("exif directory out of bounds")
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	entries := make(map[uint16]tiffEntry, count)
+
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+
+		if start+12 > len(t.data) {
+			return nil, fmt.Errorf("exif entry out of bounds")
+		}
+
+		raw := t.data[start : start+12]
+		entry := tiffEntry{
+			fieldType: t.order.Uint16(raw[2:4]),
+			count:     t.order.Uint32(raw[4:8]),
+		}
+
+		typeSize, ok := tiffTypeSizes[entry.fieldType]
+
+		if !ok {
+			continue
+		}
+
+		size := int64(typeSize) * int64(entry.count)
+
+		// Values of up to four bytes are stored in the entry itself.
+		if size <= 4 {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := int64(t.order.Uint32(raw[8:12]))
+
+			if valueOffset+size > int64(len(t.data)) {
+				continue
+			}
+
+			entry.value = t.data[valueOffset : valueOffset+size]
+		}
+
+		entries[t.order.Uint16(raw[0:2])] = entry
+	}
+
+	return entries, nil
+}
+
+func (t tiff) string(e tiffEntry) string {
+	if e.fieldType != 2 {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+func (t tiff) uint(e tiffEntry) uint32 {
+	switch {
+	case e.fieldType == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	case e.fieldType == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	case e.fieldType == 1 && len(e.value) >= 1:
+		return uint32(e.value[0])
+	}
+
+	return 0
+}
+
+func (t tiff) rationals(e tiffEntry) []float64 {
+	if e.fieldType != 5 && e.fieldType != 10 {
+		return nil
+	}
+
+	var values []float64
+
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num := t.order.Uint32(e.value[i:])
+		den := t.order.Uint32(e.value[i+4:])
+
+		if den == 0 {
+			values = append(values, 0)
+			continue
+		}
+
+		if e.fieldType == 10 {
+			values = append(values, float64(int32(num))/float64(int32(den)))
+		} else {
+			values = append(values, float64(num)/float64(den))
+		}
+	}
+
+	return values
+}
+
+func first(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	return values[0]
+}
+
+// exposureTime formats a shutter speed the way cameras show it, as a
+// fraction below one second.
+func exposureTime(values []float64) string {
+	seconds := first(values)
+
+	switch {
+	case seconds <= 0:
+		return ""
+	case seconds < 1:
+		return fmt.Sprintf("1/%g", math.Round(1/seconds))
+	default:
+		return fmt.Sprintf("%g", seconds)
+	}
+}
+
+// exifTime parses an EXIF date. Cameras store their local wall clock, so
+// without an offset the date is kept as is, in UTC.
+func exifTime(date string, offset string) *time.Time {
+	if date == "" {
+		return nil
+	}
+
+	var taken time.Time
+	var err error
+
+	if offset != "" {
+		taken, err = time.Parse(exifDateOffsetLayout, date+offset)
+	} else {
+		taken, err = time.Parse(exifDateLayout, date)
+	}
+
+	if err != nil || taken.Year() < 1900 {
+		return nil
+	}
+
+	return &taken
+}
+
+// gpsCoordinate converts degrees, minutes and seconds to decimal degrees.
+func gpsCoordinate(dms []float64, ref string, negativeRef string) *float64 {
+	if len(dms) != 3 {
+		return nil
+	}
+
+	value := dms[0] + dms[1]/60 + dms[2]/3600
+
+	if ref == negativeRef {
+		value = -value
+	}
+
+	return &value
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"reelix-go/internal/db"
+)
+
+// videoExtensions are the files in a video folder that hold the video.
+var videoExtensions = map[string]bool{
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+	".mkv":  true,
+	".webm": true,
+	".avi":  true,
+	".wmv":  true,
+	".mpg":  true,
+	".mpeg": true,
+	".ts":   true,
+	".m2ts": true,
+	".flv":  true,
+	".ogv":  true,
+}
+
+// partPattern matches the multi-part suffixes Kodi understands, like
+// "movie-cd1", "movie.part2" or "movie pt3".
+var partPattern = regexp.MustCompile(`(?i)(?:^|[ _.\-]+)(?:cd|dvd|part|pt|disc|disk)[ _.\-]*(\d+)$`)
+
+// scanVideoFiles lists the video files of a video folder, ordered by part.
+// Paths are the ones the CDN serves the files under.
+func scanVideoFiles(library Library, folderPath string, ig *ignorer) ([]db.VideoFile, error) {
+	entries, err := os.ReadDir(folderPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read video folder: %w", err)
+	}
+
+	var files []db.VideoFile
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+
+		if entry.IsDir() || !videoExtensions[ext] || ig.skip(folderPath, entry) {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return nil, err
+		}
+
+		path, err := library.filePath(filepath.Join(folderPath, entry.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, db.VideoFile{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Part:    filePart(entry.Name()),
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Part != files[j].Part {
+			return files[i].Part < files[j].Part
+		}
+
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+// filePart returns the part number of a multi-part file, or 1 for a
+// video that is a single file.
+func filePart(fileName string) int {
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	match := partPattern.FindStringSubmatch(base)
+
+	if match == nil {
+		return 1
+	}
+
+	part, err := strconv.Atoi(match[1])
+
+	if err != nil {
+		return 1
+	}
+
+	return part
+}
@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// oshashChunkSize is how much of the start and the end of a file goes
+// into its oshash.
+const oshashChunkSize = 64 * 1024
+
+// oshash computes the OpenSubtitles hash of a file: its size plus the
+// sum of the 64 bit words in its first and last 64KiB. It only reads
+// 128KiB however large the file is, which makes it cheap enough to run
+// on every file of a network-mounted library.
+func oshash(path string) (string, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	stat, err := f.Stat()
+
+	if err != nil {
+		return "", err
+	}
+
+	size := stat.Size()
+
+	if size == 0 {
+		return "", fmt.Errorf("cannot hash an empty file")
+	}
+
+	chunkSize := int64(oshashChunkSize)
+	if size < chunkSize {
+		chunkSize = size
+	}
+
+	head, err := readAt(f, 0, int(chunkSize))
+
+	if err != nil {
+		return "", err
+	}
+
+	tail, err := readAt(f, size-chunkSize, int(chunkSize))
+
+	if err != nil {
+		return "", err
+	}
+
+	return oshashSum(size, head, tail), nil
+}
+
+// oshashBytes computes the oshash of content that is already in memory,
+// such as an image inside an archive.
+func oshashBytes(data []byte) (string, error) {
+	size := int64(len(data))
+
+	if size == 0 {
+		return "", fmt.Errorf("cannot hash an empty file")
+	}
+
+	chunkSize := int64(oshashChunkSize)
+	if size < chunkSize {
+		chunkSize = size
+	}
+
+	return oshashSum(size, data[:chunkSize], data[size-chunkSize:]), nil
+}
+
+func oshashSum(size int64, head []byte, tail []byte) string {
+	hash := uint64(size) + sumWords(head) + sumWords(tail)
+
+	return fmt.Sprintf("%016x", hash)
+}
+
+// sumWords adds up buf as little endian 64 bit words, ignoring any
+// trailing bytes that don't make up a whole word.
+func sumWords(buf []byte) uint64 {
+	var sum uint64
+
+	for i := 0; i+8 <= len(buf); i += 8 {
+		sum += binary.LittleEndian.Uint64(buf[i:])
+	}
+
+	return sum
+}
+
+// sha256File hashes the whole content of a file.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hash fingerprints a file, and hashes its full content as well when the
+// scan asks for it. Failures are reported and leave the hashes empty.
+func (s *scanRun) hash(path string) (string, string) {
+	fingerprint, err := oshash(path)
+
+	if err != nil {
+		s.report.warn(path, "failed to hash file: %v", err)
+		return "", ""
+	}
+
+	if !s.fullHash {
+		return fingerprint, ""
+	}
+
+	sum, err := sha256File(path)
+
+	if err != nil {
+		s.report.warn(path, "failed to hash file: %v", err)
+		return fingerprint, ""
+	}
+
+	return fingerprint, sum
+}
+
+// hashData is hash for content that is already in memory. path is only
+// used to report failures.
+func (s *scanRun) hashData(path string, data []byte) (string, string) {
+	fingerprint, err := oshashBytes(data)
+
+	if err != nil {
+		s.report.warn(path, "failed to hash file: %v", err)
+		return "", ""
+	}
+
+	if !s.fullHash {
+		return fingerprint, ""
+	}
+
+	sum := sha256.Sum256(data)
+
+	return fingerprint, hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,231 @@
+package scanner
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ignoreFileName is the file that excludes parts of the library from
+// scanning. It uses the gitignore syntax and can be placed in any folder
+// of the library: the root, a vault, a collection, a gallery and so on.
+const ignoreFileName = ".reelixignore"
+
+// ignoreRule is a single pattern of an ignore file.
+type ignoreRule struct {
+	segments []string
+
+	// negate re-includes what an earlier pattern excluded.
+	negate bool
+
+	// dirOnly patterns end with a slash and only match directories.
+	dirOnly bool
+
+	// anchored patterns contain a slash and match the path relative to
+	// the ignore file. Others match the name at any depth.
+	anchored bool
+}
+
+// ignorer decides which paths below the library roots are ignored.
+// Ignore files are read once per ignorer, so a new one has to be made to
+// pick up changes.
+type ignorer struct {
+	roots []string
+
+	mu    sync.Mutex
+	rules map[string][]ignoreRule
+}
+
+func newIgnorer(roots ...string) *ignorer {
+	return &ignorer{
+		roots: roots,
+		rules: map[string][]ignoreRule{},
+	}
+}
+
+// skip reports whether a directory entry should be left out of a scan,
+// either because it is ignored or because it is an ignore file itself.
+func (ig *ignorer) skip(dir string, entry fs.DirEntry) bool {
+	if entry.Name() == ignoreFileName {
+		return true
+	}
+
+	return ig.ignored(filepath.Join(dir, entry.Name()), entry.IsDir())
+}
+
+// ignored reports whether path is excluded by an ignore file in any of
+// the folders above it. Like git, nothing inside an ignored folder can be
+// included again.
+func (ig *ignorer) ignored(path string, isDir bool) bool {
+	root, rel := ig.rel(path)
+
+	if rel == "" {
+		return false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	for i := range parts {
+		if ig.match(root, parts[:i+1], i < len(parts)-1 || isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rel returns the innermost root path is below, and path relative to it.
+// rel is empty for paths that aren't below any root.
+func (ig *ignorer) rel(path string) (root string, rel string) {
+	for _, r := range ig.roots {
+		p, err := filepath.Rel(r, path)
+
+		// Names like "..foo" are still below the root.
+		if err != nil || p == "." || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if rel == "" || len(r) > len(root) {
+			root, rel = r, p
+		}
+	}
+
+	return root, rel
+}
+
+// match applies the ignore files from root down to the parent of parts.
+// Deeper files are applied last and the last matching pattern wins.
+func (ig *ignorer) match(root string, parts []string, isDir bool) bool {
+	ignored := false
+	dir := root
+
+	for i := range parts {
+		for _, rule := range ig.load(dir) {
+			if rule.match(parts[i:], isDir) {
+				ignored = !rule.negate
+			}
+		}
+
+		dir = filepath.Join(dir, parts[i])
+	}
+
+	return ignored
+}
+
+func (ig *ignorer) load(dir string) []ignoreRule {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	if rules, ok := ig.rules[dir]; ok {
+		return rules
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ignoreFileName))
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("failed to read %v: %v", filepath.Join(dir, ignoreFileName), err)
+	}
+
+	rules := parseIgnore(string(data))
+	ig.rules[dir] = rules
+
+	return rules
+}
+
+// parseIgnore reads the patterns of an ignore file, skipping blank lines
+// and comments.
+func parseIgnore(data string) []ignoreRule {
+	var rules []ignoreRule
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+
+		switch {
+		case strings.HasPrefix(line, "!"):
+			rule.negate = true
+			line = line[1:]
+
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// match reports whether the rule matches parts, a path relative to the
+// folder of the ignore file.
+func (r ignoreRule) match(parts []string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+		return ok
+	}
+
+	return matchSegments(r.segments, parts)
+}
+
+// matchSegments matches a path against pattern segments, where "**"
+// matches any number of folders.
+func matchSegments(pattern []string, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// A trailing "**" matches everything inside,
+			// but not the folder itself.
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+
+		pattern, parts = pattern[1:], parts[1:]
+	}
+
+	return len(parts) == 0
+}
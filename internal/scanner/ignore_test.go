@@ -0,0 +1,43 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	root := t.TempDir()
+	movies := filepath.Join(root, "vaults", "home", "videos", "movies")
+
+	writeTestFile(t, filepath.Join(root, ignoreFileName), []byte("# comment\n*.tmp\nextras/\n/vaults/home/private\n**/cache/**\n"))
+	writeTestFile(t, filepath.Join(movies, ignoreFileName), []byte("!keep.tmp\n\\#raw\n"))
+
+	ig := newIgnorer(root)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{filepath.Join(movies, "the_film", "the_film.mp4"), false, false},
+		{filepath.Join(movies, "the_film", "part.tmp"), false, true},
+		{filepath.Join(movies, "keep.tmp"), false, false},
+		{filepath.Join(movies, "#raw"), true, true},
+		{filepath.Join(movies, "the_film", "extras"), true, true},
+		{filepath.Join(movies, "the_film", "extras"), false, false},
+		{filepath.Join(movies, "the_film", "extras", "trailer.mp4"), false, true},
+		{filepath.Join(root, "vaults", "home", "private"), true, true},
+		{filepath.Join(movies, "private"), true, false},
+		{filepath.Join(movies, "cache"), true, false},
+		{filepath.Join(movies, "cache", "thumb.jpg"), false, true},
+		{filepath.Join(root, "..foo", "part.tmp"), false, true},
+		{filepath.Join(filepath.Dir(root), "part.tmp"), false, false},
+		{root, true, false},
+	}
+
+	for _, test := range tests {
+		if got := ig.ignored(test.path, test.isDir); got != test.want {
+			t.Errorf("ignored(%v, %v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
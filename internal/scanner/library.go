@@ -0,0 +1,266 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Library describes where the vaults of the library live on disk. It can
+// span several roots, usually one per mount.
+type Library struct {
+	Roots []Root `json:"roots"`
+}
+
+// Root is a directory vaults are read from.
+type Root struct {
+	Path string `json:"path"`
+
+	// Prefix is put in front of the paths of video files below Path,
+	// which are relative to it, so the CDN can tell roots apart.
+	Prefix string `json:"prefix"`
+
+	// Discover is a folder below Path whose every subfolder is a vault
+	// with the root's layout. Empty only uses the vaults listed.
+	Discover string `json:"discover"`
+
+	// Layout is the layout of the vaults of this root, unless a vault
+	// has its own.
+	Layout Layout `json:"layout"`
+
+	Vaults []VaultConfig `json:"vaults"`
+}
+
+// Layout names the folders of a vault. Videos and pictures are relative
+// to the vault, actors to the pictures. Any of them may be absolute
+// instead, as long as they stay within the root.
+type Layout struct {
+	Videos   string `json:"videos"`
+	Pictures string `json:"pictures"`
+	Actors   string `json:"actors"`
+}
+
+// VaultConfig is a vault at a folder of its choosing. Path is relative to
+// the root or absolute, and the layout fields left empty are the root's.
+type VaultConfig struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	Layout
+}
+
+var defaultLayout = Layout{
+	Videos:   "videos",
+	Pictures: "pictures",
+	Actors:   "actors",
+}
+
+// vaultLayout is where the parts of a single vault are, as absolute paths.
+type vaultLayout struct {
+	name     string
+	path     string
+	videos   string
+	pictures string
+	actors   string
+}
+
+// DefaultLibrary is the classic single root library, with every folder
+// of root/vaults being a vault.
+func DefaultLibrary(root string) Library {
+	return Library{
+		Roots: []Root{{Path: root, Discover: "vaults"}},
+	}
+}
+
+// LoadLibrary reads a library from a JSON file.
+func LoadLibrary(configPath string) (Library, error) {
+	data, err := os.ReadFile(configPath)
+
+	if err != nil {
+		return Library{}, fmt.Errorf("failed to read library config: %w", err)
+	}
+
+	var library Library
+
+	if err := json.Unmarshal(data, &library); err != nil {
+		return Library{}, fmt.Errorf("failed to parse library config: %w", err)
+	}
+
+	if err := library.validate(); err != nil {
+		return Library{}, err
+	}
+
+	return library, nil
+}
+
+func (l Library) validate() error {
+	if len(l.Roots) == 0 {
+		return fmt.Errorf("library has no roots")
+	}
+
+	names := map[string]bool{}
+
+	for _, root := range l.Roots {
+		if !filepath.IsAbs(root.Path) {
+			return fmt.Errorf("library root %q is not an absolute path", root.Path)
+		}
+
+		for _, v := range root.Vaults {
+			if v.Name == "" || strings.ContainsAny(v.Name, `/\`) {
+				return fmt.Errorf("invalid vault name %q", v.Name)
+			}
+
+			if names[v.Name] {
+				return fmt.Errorf("vault %q is configured twice", v.Name)
+			}
+
+			names[v.Name] = true
+
+			layout := root.vaultLayout(v)
+
+			for _, p := range []string{layout.path, layout.videos, layout.pictures, layout.actors} {
+				if !within(root.Path, p) {
+					return fmt.Errorf("vault %q reaches outside of root %v: %v", v.Name, root.Path, p)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// paths lists the root folders of the library.
+func (l Library) paths() []string {
+	paths := make([]string, 0, len(l.Roots))
+
+	for _, root := range l.Roots {
+		paths = append(paths, root.Path)
+	}
+
+	return paths
+}
+
+// vaults resolves the vaults of every root. Discovered vaults never
+// replace configured ones of the same name, nor ones found earlier.
+func (l Library) vaults(ig *ignorer) ([]vaultLayout, error) {
+	var layouts []vaultLayout
+	seen := map[string]bool{}
+
+	for _, root := range l.Roots {
+		for _, v := range root.Vaults {
+			if seen[v.Name] {
+				continue
+			}
+
+			layout := root.vaultLayout(v)
+
+			if ig.ignored(layout.path, true) {
+				continue
+			}
+
+			seen[v.Name] = true
+			layouts = append(layouts, layout)
+		}
+	}
+
+	for _, root := range l.Roots {
+		if root.Discover == "" {
+			continue
+		}
+
+		discoverPath := filepath.Join(root.Path, root.Discover)
+		entries, err := os.ReadDir(discoverPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault: %w", err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || ig.skip(discoverPath, entry) {
+				continue
+			}
+
+			if seen[entry.Name()] {
+				log.Printf("skipping vault %v in %v, there already is one by that name", entry.Name(), discoverPath)
+				continue
+			}
+
+			seen[entry.Name()] = true
+			layouts = append(layouts, root.vaultLayout(VaultConfig{
+				Name: entry.Name(),
+				Path: filepath.Join(root.Discover, entry.Name()),
+			}))
+		}
+	}
+
+	return layouts, nil
+}
+
+// discoverPaths lists the folders vaults are discovered in.
+func (l Library) discoverPaths() []string {
+	var paths []string
+
+	for _, root := range l.Roots {
+		if root.Discover != "" {
+			paths = append(paths, filepath.Join(root.Path, root.Discover))
+		}
+	}
+
+	return paths
+}
+
+// filePath turns the absolute path of a file into the path the CDN serves
+// it under: its path relative to its root, behind the root's prefix.
+func (l Library) filePath(p string) (string, error) {
+	for _, root := range l.Roots {
+		if within(root.Path, p) {
+			rel, err := filepath.Rel(root.Path, p)
+
+			if err != nil {
+				return "", err
+			}
+
+			return path.Join(root.Prefix, filepath.ToSlash(rel)), nil
+		}
+	}
+
+	return "", fmt.Errorf("%v is not in the library", p)
+}
+
+func (r Root) vaultLayout(v VaultConfig) vaultLayout {
+	videos := firstNonEmpty(v.Videos, r.Layout.Videos, defaultLayout.Videos)
+	pictures := firstNonEmpty(v.Pictures, r.Layout.Pictures, defaultLayout.Pictures)
+	actors := firstNonEmpty(v.Actors, r.Layout.Actors, defaultLayout.Actors)
+
+	layout := vaultLayout{
+		name: v.Name,
+		path: resolve(r.Path, v.Path),
+	}
+
+	layout.videos = resolve(layout.path, videos)
+	layout.pictures = resolve(layout.path, pictures)
+	layout.actors = resolve(layout.pictures, actors)
+
+	return layout
+}
+
+// resolve returns p as it is when it is absolute and relative to dir
+// otherwise.
+func resolve(dir string, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+
+	return filepath.Join(dir, p)
+}
+
+// within reports whether p is dir or below it.
+func within(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"encoding/xml"
+	"os"
+	"strconv"
+	"strings"
+
+	"reelix-go/internal/db"
+)
+
+// VideoMetadata follows the Kodi movie .nfo schema.
+// See https://kodi.wiki/view/NFO_files/Movies
+type VideoMetadata struct {
+	Title      string        `xml:"title"`
+	SortTitle  string        `xml:"sorttitle"`
+	Plot       string        `xml:"plot"`
+	Outline    string        `xml:"outline"`
+	Tagline    string        `xml:"tagline"`
+	Year       int           `xml:"year"`
+	Premiered  string        `xml:"premiered"`
+	Runtime    int           `xml:"runtime"`
+	Ratings    []db.Rating   `xml:"ratings>rating"`
+	UserRating float64       `xml:"userrating"`
+	MPAA       string        `xml:"mpaa"`
+	Directors  []string      `xml:"director"`
+	Credits    []string      `xml:"credits"`
+	Genres     []string      `xml:"genre"`
+	Countries  []string      `xml:"country"`
+	Set        nfoSet        `xml:"set"`
+	UniqueIDs  []db.UniqueID `xml:"uniqueid"`
+	Thumbs     []db.Artwork  `xml:"thumb"`
+	Fanart     []db.Artwork  `xml:"fanart>thumb"`
+	Studio     string        `xml:"studio"`
+	Tags       []string      `xml:"tag"`
+	Actors     []db.Actor    `xml:"actor"`
+
+	// Older .nfo files have a single rating instead of <ratings>.
+	Rating string `xml:"rating"`
+	Votes  string `xml:"votes"`
+}
+
+// nfoSet accepts both <set><name>...</name></set> and the older
+// <set>name</set> form.
+type nfoSet struct {
+	Name     string `xml:"name"`
+	Overview string `xml:"overview"`
+	Text     string `xml:",chardata"`
+}
+
+func parseNfoFile(nfoPath string) (VideoMetadata, error) {
+	data, err := os.ReadFile(nfoPath)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+
+	var metadata VideoMetadata
+	err = xml.Unmarshal(data, &metadata)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+
+	return metadata, nil
+}
+
+func (m VideoMetadata) video(slug string) db.Video {
+	setName := strings.TrimSpace(m.Set.Name)
+	if setName == "" {
+		setName = strings.TrimSpace(m.Set.Text)
+	}
+
+	year := m.Year
+	if year == 0 && len(m.Premiered) >= 4 {
+		year, _ = strconv.Atoi(m.Premiered[:4])
+	}
+
+	ratings := m.Ratings
+
+	if len(ratings) == 0 && m.Rating != "" {
+		value, err := strconv.ParseFloat(strings.TrimSpace(m.Rating), 64)
+
+		if err == nil {
+			votes, _ := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(m.Votes), ",", ""))
+
+			ratings = []db.Rating{{Name: "default", Value: value, Votes: votes, Max: 10, Default: true}}
+		}
+	}
+
+	var artwork []db.Artwork
+
+	for _, thumb := range m.Thumbs {
+		thumb.Kind = "thumb"
+		artwork = appendArtwork(artwork, thumb)
+	}
+
+	for _, fanart := range m.Fanart {
+		fanart.Kind = "fanart"
+		artwork = appendArtwork(artwork, fanart)
+	}
+
+	uniqueIDs := make([]db.UniqueID, 0, len(m.UniqueIDs))
+
+	for _, id := range m.UniqueIDs {
+		id.Value = strings.TrimSpace(id.Value)
+
+		if id.Value != "" {
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+
+	return db.Video{
+		Title:       m.Title,
+		SortTitle:   m.SortTitle,
+		Slug:        slug,
+		Studio:      m.Studio,
+		Plot:        m.Plot,
+		Outline:     m.Outline,
+		Tagline:     m.Tagline,
+		Year:        year,
+		Premiered:   m.Premiered,
+		Runtime:     m.Runtime,
+		Ratings:     ratings,
+		UserRating:  m.UserRating,
+		MPAA:        m.MPAA,
+		Directors:   m.Directors,
+		Credits:     m.Credits,
+		Genres:      m.Genres,
+		Countries:   m.Countries,
+		SetName:     setName,
+		SetOverview: m.Set.Overview,
+		UniqueIDs:   uniqueIDs,
+		Artwork:     artwork,
+		Tags:        m.Tags,
+		Actors:      m.Actors,
+	}
+}
+
+func appendArtwork(artwork []db.Artwork, art db.Artwork) []db.Artwork {
+	art.URL = strings.TrimSpace(art.URL)
+
+	if art.URL == "" {
+		return artwork
+	}
+
+	return append(artwork, art)
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// posterNames are the names Kodi looks for a local poster under, in order
+// of preference. The first one is prefixed with the video slug.
+var posterNames = []string{"-poster", "poster", "folder", "cover"}
+
+var posterExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// findPoster returns the path of the poster image in a video folder, or
+// an empty string when there is none.
+func findPoster(folderPath string, slug string, ig *ignorer) string {
+	for i, name := range posterNames {
+		if i == 0 {
+			name = slug + name
+		}
+
+		for _, ext := range posterExtensions {
+			path := filepath.Join(folderPath, name+ext)
+			info, err := os.Stat(path)
+
+			if err == nil && info.Mode().IsRegular() && !ig.ignored(path, false) {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"reelix-go/internal/db"
+)
+
+var errUnsupportedMedia = errors.New("unsupported media container")
+
+// probeExtensions are the video files we know how to probe.
+var probeExtensions = map[string]bool{
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+	".mkv":  true,
+	".webm": true,
+}
+
+// probeMedia reads the container headers of an ISO-BMFF (mp4/mov/m4v) or
+// Matroska/WebM file without decoding any of the media itself.
+func probeMedia(path string) (*db.MediaInfo, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	stat, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var magic [12]byte
+
+	if _, err := f.ReadAt(magic[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var info *db.MediaInfo
+
+	switch {
+	case bytes.Equal(magic[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		info, err = probeMatroska(f, stat.Size())
+
+	case isMP4Box(string(magic[4:8])):
+		info, err = probeMP4(f, stat.Size())
+
+	default:
+		return nil, errUnsupportedMedia
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Duration > 0 {
+		info.Bitrate = int64(float64(stat.Size()*8) / info.Duration)
+	}
+
+	return info, nil
+}
+
+func isMP4Box(boxType string) bool {
+	switch boxType {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide":
+		return true
+	}
+
+	return false
+}
+
+// readAt reads exactly n bytes at off.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,358 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"reelix-go/internal/db"
+)
+
+// Matroska element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	ebmlHeaderID     = 0x1A45DFA3
+	ebmlDocTypeID    = 0x4282
+	mkvSegmentID     = 0x18538067
+	mkvInfoID        = 0x1549A966
+	mkvTimescaleID   = 0x2AD7B1
+	mkvDurationID    = 0x4489
+	mkvTracksID      = 0x1654AE6B
+	mkvTrackEntryID  = 0xAE
+	mkvTrackTypeID   = 0x83
+	mkvCodecID       = 0x86
+	mkvLanguageID    = 0x22B59C
+	mkvLanguageBCPID = 0x22B59D
+	mkvVideoID       = 0xE0
+	mkvPixelWidthID  = 0xB0
+	mkvPixelHeightID = 0xBA
+	mkvClusterID     = 0x1F43B675
+
+	mkvTrackVideo = 1
+	mkvTrackAudio = 2
+)
+
+// mkvCodecs maps Matroska codec IDs (or their prefixes) to the codec
+// names we report.
+var mkvCodecs = []struct {
+	prefix string
+	name   string
+}{
+	{"V_MPEG4/ISO/AVC", "h264"},
+	{"V_MPEGH/ISO/HEVC", "hevc"},
+	{"V_AV1", "av1"},
+	{"V_VP9", "vp9"},
+	{"V_VP8", "vp8"},
+	{"V_MPEG4", "mpeg4"},
+	{"V_MPEG2", "mpeg2"},
+	{"A_AAC", "aac"},
+	{"A_EAC3", "eac3"},
+	{"A_AC3", "ac3"},
+	{"A_DTS", "dts"},
+	{"A_TRUEHD", "truehd"},
+	{"A_OPUS", "opus"},
+	{"A_VORBIS", "vorbis"},
+	{"A_FLAC", "flac"},
+	{"A_MPEG/L3", "mp3"},
+	{"A_PCM", "pcm"},
+}
+
+// ebmlElement is an element whose data starts at offset and is size
+// bytes long. Elements of unknown size run until the end of their parent.
+type ebmlElement struct {
+	id     uint64
+	offset int64
+	size   int64
+}
+
+type mkvTrack struct {
+	trackType uint64
+	codec     string
+	language  string
+	width     int
+	height    int
+}
+
+// probeMatroska reads the EBML header, the segment info and the track
+// list of a Matroska or WebM file and stops at the first cluster.
+func probeMatroska(r io.ReaderAt, size int64) (*db.MediaInfo, error) {
+	info := &db.MediaInfo{Container: "mkv"}
+	timescale := uint64(1000000)
+	var duration float64
+	var tracks []mkvTrack
+
+	err := ebmlElements(r, 0, size, func(el ebmlElement) (bool, error) {
+		switch el.id {
+		case ebmlHeaderID:
+			return false, ebmlElements(r, el.offset, el.offset+el.size, func(child ebmlElement) (bool, error) {
+				if child.id == ebmlDocTypeID {
+					docType, err := ebmlString(r, child)
+
+					if err == nil && docType == "webm" {
+						info.Container = "webm"
+					}
+				}
+
+				return false, nil
+			})
+
+		case mkvSegmentID:
+			return true, ebmlElements(r, el.offset, el.offset+el.size, func(child ebmlElement) (bool, error) {
+				switch child.id {
+				case mkvInfoID:
+					return false, ebmlElements(r, child.offset, child.offset+child.size, func(field ebmlElement) (bool, error) {
+						var err error
+
+						switch field.id {
+						case mkvTimescaleID:
+							timescale, err = ebmlUint(r, field)
+						case mkvDurationID:
+							duration, err = ebmlFloat(r, field)
+						}
+
+						return false, err
+					})
+
+				case mkvTracksID:
+					return false, ebmlElements(r, child.offset, child.offset+child.size, func(entry ebmlElement) (bool, error) {
+						if entry.id != mkvTrackEntryID {
+							return false, nil
+						}
+
+						track, err := mkvParseTrack(r, entry)
+
+						if err != nil {
+							return false, err
+						}
+
+						tracks = append(tracks, track)
+
+						return false, nil
+					})
+
+				case mkvClusterID:
+					// The headers we need come before the media data.
+					return true, nil
+				}
+
+				return false, nil
+			})
+		}
+
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	info.Duration = duration * float64(timescale) / 1e9
+
+	for _, t := range tracks {
+		switch t.trackType {
+		case mkvTrackVideo:
+			if info.VideoCodec == "" {
+				info.VideoCodec = t.codec
+				info.Width = t.width
+				info.Height = t.height
+			}
+
+		case mkvTrackAudio:
+			info.AudioCodecs = append(info.AudioCodecs, t.codec)
+			info.AudioLanguages = append(info.AudioLanguages, t.language)
+		}
+	}
+
+	return info, nil
+}
+
+func mkvParseTrack(r io.ReaderAt, entry ebmlElement) (mkvTrack, error) {
+	// Matroska defaults the language to English when it is missing.
+	track := mkvTrack{language: "eng"}
+	bcp47 := ""
+
+	err := ebmlElements(r, entry.offset, entry.offset+entry.size, func(field ebmlElement) (bool, error) {
+		var err error
+
+		switch field.id {
+		case mkvTrackTypeID:
+			track.trackType, err = ebmlUint(r, field)
+
+		case mkvCodecID:
+			var codec string
+			codec, err = ebmlString(r, field)
+			track.codec = mkvCodecName(codec)
+
+		case mkvLanguageID:
+			track.language, err = ebmlString(r, field)
+
+		case mkvLanguageBCPID:
+			bcp47, err = ebmlString(r, field)
+
+		case mkvVideoID:
+			err = ebmlElements(r, field.offset, field.offset+field.size, func(video ebmlElement) (bool, error) {
+				var err error
+				var value uint64
+
+				switch video.id {
+				case mkvPixelWidthID:
+					value, err = ebmlUint(r, video)
+					track.width = int(value)
+
+				case mkvPixelHeightID:
+					value, err = ebmlUint(r, video)
+					track.height = int(value)
+				}
+
+				return false, err
+			})
+		}
+
+		return false, err
+	})
+
+	// LanguageBCP47 takes precedence over Language when both are set.
+	if bcp47 != "" {
+		track.language = bcp47
+	}
+
+	return track, err
+}
+
+// ebmlElements calls fn for every element between start and end until fn
+// asks to stop.
+func ebmlElements(r io.ReaderAt, start int64, end int64, fn func(el ebmlElement) (bool, error)) error {
+	for offset := start; offset < end; {
+		id, idLength, err := ebmlVint(r, offset, true)
+
+		if err != nil {
+			return fmt.Errorf("failed to read element id at %d: %w", offset, err)
+		}
+
+		size, sizeLength, err := ebmlVint(r, offset+int64(idLength), false)
+
+		if err != nil {
+			return fmt.Errorf("failed to read element size at %d: %w", offset, err)
+		}
+
+		dataOffset := offset + int64(idLength) + int64(sizeLength)
+		dataSize := int64(size)
+
+		// All value bits set means the size is unknown.
+		if size == 1<<(7*sizeLength)-1 || dataOffset+dataSize > end {
+			dataSize = end - dataOffset
+		}
+
+		stop, err := fn(ebmlElement{id: id, offset: dataOffset, size: dataSize})
+
+		if err != nil || stop {
+			return err
+		}
+
+		offset = dataOffset + dataSize
+	}
+
+	return nil
+}
+
+// ebmlVint reads a variable length integer. Element IDs keep their length
+// marker bit, sizes don't.
+func ebmlVint(r io.ReaderAt, offset int64, keepMarker bool) (uint64, int, error) {
+	first, err := readAt(r, offset, 1)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := 1
+
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+
+	if length > 8 {
+		return 0, 0, fmt.Errorf("invalid variable length integer")
+	}
+
+	buf, err := readAt(r, offset, length)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value := uint64(buf[0])
+
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+
+	for _, b := range buf[1:] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, length, nil
+}
+
+func ebmlUint(r io.ReaderAt, el ebmlElement) (uint64, error) {
+	if el.size > 8 {
+		return 0, fmt.Errorf("unsigned integer element too large")
+	}
+
+	buf, err := readAt(r, el.offset, int(el.size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	var value uint64
+
+	for _, b := range buf {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, nil
+}
+
+func ebmlFloat(r io.ReaderAt, el ebmlElement) (float64, error) {
+	buf, err := readAt(r, el.offset, int(el.size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(buf) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+	case 0:
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("invalid float element size %d", len(buf))
+}
+
+func ebmlString(r io.ReaderAt, el ebmlElement) (string, error) {
+	if el.size > 1024 {
+		return "", fmt.Errorf("string element too large")
+	}
+
+	buf, err := readAt(r, el.offset, int(el.size))
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(buf), "\x00"), nil
+}
+
+func mkvCodecName(codecID string) string {
+	for _, c := range mkvCodecs {
+		if strings.HasPrefix(codecID, c.prefix) {
+			return c.name
+		}
+	}
+
+	return strings.ToLower(codecID)
+}
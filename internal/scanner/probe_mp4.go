@@ -0,0 +1,330 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"reelix-go/internal/db"
+)
+
+// mp4Codecs maps sample entry types to the codec names we report.
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"vp08": "vp8",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"alac": "alac",
+}
+
+// mp4Box is a box whose payload starts at offset and is size bytes long.
+type mp4Box struct {
+	boxType string
+	offset  int64
+	size    int64
+}
+
+type mp4Track struct {
+	handler   string
+	codec     string
+	language  string
+	width     int
+	height    int
+	timescale uint32
+	duration  uint64
+}
+
+// probeMP4 reads an ISO base media file (mp4, m4v, mov). Only the ftyp
+// and moov boxes are parsed, mdat is skipped over however large it is.
+func probeMP4(r io.ReaderAt, size int64) (*db.MediaInfo, error) {
+	info := &db.MediaInfo{Container: "mp4"}
+
+	var timescale uint32
+	var duration uint64
+	var tracks []mp4Track
+	foundMoov := false
+
+	err := mp4Boxes(r, 0, size, func(box mp4Box) error {
+		switch box.boxType {
+		case "ftyp":
+			brand, err := readAt(r, box.offset, 4)
+
+			if err != nil {
+				return err
+			}
+
+			switch string(brand) {
+			case "qt  ":
+				info.Container = "mov"
+			case "M4V ", "M4VH", "M4VP":
+				info.Container = "m4v"
+			}
+
+		case "moov":
+			foundMoov = true
+
+			return mp4Boxes(r, box.offset, box.offset+box.size, func(child mp4Box) error {
+				switch child.boxType {
+				case "mvhd":
+					var err error
+					timescale, duration, err = mp4Duration(r, child)
+					return err
+
+				case "trak":
+					track, err := mp4ParseTrack(r, child)
+
+					if err != nil {
+						return err
+					}
+
+					tracks = append(tracks, track)
+				}
+
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !foundMoov {
+		return nil, fmt.Errorf("mp4 has no moov box")
+	}
+
+	if timescale > 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+
+	for _, t := range tracks {
+		// Fragmented files leave the movie duration empty,
+		// so fall back to the longest track.
+		if t.timescale > 0 {
+			if d := float64(t.duration) / float64(t.timescale); d > info.Duration {
+				info.Duration = d
+			}
+		}
+
+		switch t.handler {
+		case "vide":
+			if info.VideoCodec == "" {
+				info.VideoCodec = t.codec
+				info.Width = t.width
+				info.Height = t.height
+			}
+
+		case "soun":
+			info.AudioCodecs = append(info.AudioCodecs, t.codec)
+			info.AudioLanguages = append(info.AudioLanguages, t.language)
+		}
+	}
+
+	return info, nil
+}
+
+// mp4Boxes calls fn for every box between start and end.
+func mp4Boxes(r io.ReaderAt, start int64, end int64, fn func(box mp4Box) error) error {
+	for offset := start; offset+8 <= end; {
+		header, err := readAt(r, offset, 8)
+
+		if err != nil {
+			return fmt.Errorf("failed to read box at %d: %w", offset, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// The box runs until the end of its parent.
+			size = end - offset
+
+		case 1:
+			largeSize, err := readAt(r, offset+8, 8)
+
+			if err != nil {
+				return err
+			}
+
+			size = int64(binary.BigEndian.Uint64(largeSize))
+			headerSize = 16
+		}
+
+		if size < headerSize || offset+size > end {
+			return fmt.Errorf("invalid %q box at %d", boxType, offset)
+		}
+
+		if err := fn(mp4Box{boxType: boxType, offset: offset + headerSize, size: size - headerSize}); err != nil {
+			return err
+		}
+
+		offset += size
+	}
+
+	return nil
+}
+
+// mp4Duration reads the timescale and duration of an mvhd or mdhd box.
+// Both start with version and flags followed by creation and modification
+// times, which are 32 bits wide in version 0 and 64 bits in version 1.
+func mp4Duration(r io.ReaderAt, box mp4Box) (uint32, uint64, error) {
+	version, err := readAt(r, box.offset, 1)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if version[0] == 1 {
+		buf, err := readAt(r, box.offset+20, 12)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return binary.BigEndian.Uint32(buf[0:4]), binary.BigEndian.Uint64(buf[4:12]), nil
+	}
+
+	buf, err := readAt(r, box.offset+12, 8)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return binary.BigEndian.Uint32(buf[0:4]), uint64(binary.BigEndian.Uint32(buf[4:8])), nil
+}
+
+func mp4ParseTrack(r io.ReaderAt, trak mp4Box) (mp4Track, error) {
+	var track mp4Track
+
+	err := mp4Boxes(r, trak.offset, trak.offset+trak.size, func(box mp4Box) error {
+		switch box.boxType {
+		case "tkhd":
+			// Width and height are 16.16 fixed point numbers
+			// at the very end of the box.
+			if box.size < 8 {
+				return nil
+			}
+
+			buf, err := readAt(r, box.offset+box.size-8, 8)
+
+			if err != nil {
+				return err
+			}
+
+			track.width = int(binary.BigEndian.Uint32(buf[0:4]) >> 16)
+			track.height = int(binary.BigEndian.Uint32(buf[4:8]) >> 16)
+
+		case "mdia":
+			return mp4ParseMedia(r, box, &track)
+		}
+
+		return nil
+	})
+
+	return track, err
+}
+
+func mp4ParseMedia(r io.ReaderAt, mdia mp4Box, track *mp4Track) error {
+	return mp4Boxes(r, mdia.offset, mdia.offset+mdia.size, func(box mp4Box) error {
+		switch box.boxType {
+		case "mdhd":
+			var err error
+			track.timescale, track.duration, err = mp4Duration(r, box)
+
+			if err != nil {
+				return err
+			}
+
+			version, err := readAt(r, box.offset, 1)
+
+			if err != nil {
+				return err
+			}
+
+			languageOffset := int64(20)
+			if version[0] == 1 {
+				languageOffset = 32
+			}
+
+			buf, err := readAt(r, box.offset+languageOffset, 2)
+
+			if err != nil {
+				return err
+			}
+
+			track.language = mp4Language(binary.BigEndian.Uint16(buf))
+
+		case "hdlr":
+			buf, err := readAt(r, box.offset+8, 4)
+
+			if err != nil {
+				return err
+			}
+
+			track.handler = string(buf)
+
+		case "minf":
+			return mp4Boxes(r, box.offset, box.offset+box.size, func(child mp4Box) error {
+				if child.boxType != "stbl" {
+					return nil
+				}
+
+				return mp4Boxes(r, child.offset, child.offset+child.size, func(stbl mp4Box) error {
+					if stbl.boxType != "stsd" || stbl.size < 16 {
+						return nil
+					}
+
+					// The first sample entry follows version, flags
+					// and the entry count.
+					buf, err := readAt(r, stbl.offset+12, 4)
+
+					if err != nil {
+						return err
+					}
+
+					track.codec = mp4CodecName(string(buf))
+
+					return nil
+				})
+			})
+		}
+
+		return nil
+	})
+}
+
+// mp4Language unpacks an ISO-639-2/T code stored as three 5 bit letters.
+func mp4Language(packed uint16) string {
+	if packed == 0 || packed == 0x7FFF {
+		return "und"
+	}
+
+	return string([]byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	})
+}
+
+func mp4CodecName(fourcc string) string {
+	if name, ok := mp4Codecs[fourcc]; ok {
+		return name
+	}
+
+	return strings.ToLower(strings.TrimSpace(fourcc))
+}
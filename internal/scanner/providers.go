@@ -0,0 +1,280 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"reelix-go/internal/db"
+	"reelix-go/internal/utils"
+)
+
+// errNoMetadata is returned by a provider that has nothing to say about a
+// video folder, which is not an error in itself.
+var errNoMetadata = errors.New("no metadata")
+
+// MetadataProvider reads the metadata of a video from somewhere in or
+// about its folder. Providers run in a chain and every one of them only
+// fills the fields the providers before it left empty.
+type MetadataProvider interface {
+	// Name identifies the provider in the scan report and in the
+	// METADATA_PROVIDERS setting.
+	Name() string
+
+	// Metadata returns errNoMetadata when the provider has nothing
+	// for the folder.
+	Metadata(folderPath string, folderName string) (db.Video, error)
+}
+
+// DefaultPattern reads "Studio - Title (2021)" style folder names, where
+// the studio and the year are optional.
+const DefaultPattern = `^(?:(?P<studio>.+?) - )?(?P<title>.+?)(?: \((?P<year>\d{4})\))?$`
+
+// DefaultProviders is the chain used when none is configured: the Kodi
+// .nfo first, then a JSON sidecar, then whatever the folder name says.
+func DefaultProviders() []MetadataProvider {
+	return []MetadataProvider{
+		NfoProvider{},
+		JSONProvider{},
+		PatternProvider{Pattern: regexp.MustCompile(DefaultPattern)},
+	}
+}
+
+// NewProviders builds a provider chain from provider names ("nfo",
+// "json" and "pattern") in order. The pattern provider uses pattern, or
+// DefaultPattern when it is empty.
+func NewProviders(names []string, pattern string) ([]MetadataProvider, error) {
+	if pattern == "" {
+		pattern = DefaultPattern
+	}
+
+	var providers []MetadataProvider
+
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "nfo":
+			providers = append(providers, NfoProvider{})
+
+		case "json":
+			providers = append(providers, JSONProvider{})
+
+		case "pattern":
+			re, err := regexp.Compile(pattern)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata pattern: %w", err)
+			}
+
+			providers = append(providers, PatternProvider{Pattern: re})
+
+		case "":
+
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %q", name)
+		}
+	}
+
+	return providers, nil
+}
+
+// providersKey identifies a provider chain along with its pattern, so a
+// video read with another chain isn't taken for one that is up to date.
+func providersKey(providers []MetadataProvider) string {
+	keys := make([]string, len(providers))
+
+	for i, provider := range providers {
+		keys[i] = provider.Name()
+
+		if p, ok := provider.(PatternProvider); ok {
+			keys[i] += "=" + p.Pattern.String()
+		}
+	}
+
+	return strings.Join(keys, "\x00")
+}
+
+// NfoProvider reads the Kodi .nfo named after the folder.
+type NfoProvider struct{}
+
+func (NfoProvider) Name() string {
+	return "nfo"
+}
+
+func (NfoProvider) Metadata(folderPath string, folderName string) (db.Video, error) {
+	nfoPath := filepath.Join(folderPath, folderName+".nfo")
+
+	if _, err := os.Stat(nfoPath); err != nil {
+		return db.Video{}, errNoMetadata
+	}
+
+	metadata, err := parseNfoFile(nfoPath)
+
+	if err != nil {
+		return db.Video{}, fmt.Errorf("failed to parse .nfo: %w", err)
+	}
+
+	return metadata.video(folderName), nil
+}
+
+// JSONProvider reads a .json sidecar named after the folder. It uses the
+// same field names as the video API, so a video can be exported and
+// edited by hand.
+type JSONProvider struct{}
+
+func (JSONProvider) Name() string {
+	return "json"
+}
+
+func (JSONProvider) Metadata(folderPath string, folderName string) (db.Video, error) {
+	data, err := os.ReadFile(filepath.Join(folderPath, folderName+".json"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return db.Video{}, errNoMetadata
+	}
+
+	if err != nil {
+		return db.Video{}, err
+	}
+
+	var v db.Video
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return db.Video{}, fmt.Errorf("failed to parse .json: %w", err)
+	}
+
+	// Only metadata is taken from the sidecar. Ids, files and
+	// media are for the library to work out.
+	return db.Video{
+		Title:       v.Title,
+		SortTitle:   v.SortTitle,
+		Studio:      v.Studio,
+		Plot:        v.Plot,
+		Outline:     v.Outline,
+		Tagline:     v.Tagline,
+		Year:        v.Year,
+		Premiered:   v.Premiered,
+		Runtime:     v.Runtime,
+		Ratings:     v.Ratings,
+		UserRating:  v.UserRating,
+		MPAA:        v.MPAA,
+		Directors:   v.Directors,
+		Credits:     v.Credits,
+		Genres:      v.Genres,
+		Countries:   v.Countries,
+		SetName:     v.SetName,
+		SetOverview: v.SetOverview,
+		UniqueIDs:   v.UniqueIDs,
+		Artwork:     v.Artwork,
+		Tags:        v.Tags,
+		Actors:      v.Actors,
+	}, nil
+}
+
+// PatternProvider reads the title, studio and year from the folder name
+// with the named groups "title", "studio" and "year" of Pattern. Snake
+// case folder names are read as words.
+type PatternProvider struct {
+	Pattern *regexp.Regexp
+}
+
+func (PatternProvider) Name() string {
+	return "pattern"
+}
+
+func (p PatternProvider) Metadata(folderPath string, folderName string) (db.Video, error) {
+	name := folderName
+
+	if !strings.Contains(name, " ") {
+		name = utils.SnakeToTitle(name)
+	}
+
+	match := p.Pattern.FindStringSubmatch(name)
+
+	if match == nil {
+		return db.Video{}, errNoMetadata
+	}
+
+	var video db.Video
+
+	for i, group := range p.Pattern.SubexpNames() {
+		value := strings.TrimSpace(match[i])
+
+		switch group {
+		case "title":
+			video.Title = value
+		case "studio":
+			video.Studio = value
+		case "year":
+			video.Year, _ = strconv.Atoi(value)
+		}
+	}
+
+	if video.Title == "" {
+		return db.Video{}, errNoMetadata
+	}
+
+	return video, nil
+}
+
+// metadata runs the provider chain over a video folder. A provider that
+// fails stops the chain, so a broken .nfo isn't silently replaced by
+// whatever the folder name says. A folder the name is all we know about
+// is still reported, as the pattern matches nearly any folder.
+func (s *scanRun) metadata(folderPath string, folderName string) (db.Video, bool) {
+	var video db.Video
+	found := false
+	onlyName := true
+
+	for _, p := range s.providers {
+		v, err := p.Metadata(folderPath, folderName)
+
+		if errors.Is(err, errNoMetadata) {
+			continue
+		}
+
+		if err != nil {
+			s.report.fail(folderPath, fmt.Errorf("%v metadata: %w", p.Name(), err))
+			return db.Video{}, false
+		}
+
+		mergeMetadata(&video, v)
+		found = true
+
+		if _, ok := p.(PatternProvider); !ok {
+			onlyName = false
+		}
+	}
+
+	if !found {
+		s.report.warn(folderPath, "no metadata found")
+		return db.Video{}, false
+	}
+
+	if onlyName {
+		s.report.warn(folderPath, "no metadata found, using the folder name")
+	}
+
+	video.Slug = folderName
+
+	return video, true
+}
+
+// mergeMetadata fills the fields of dst that are still empty from src.
+func mergeMetadata(dst *db.Video, src db.Video) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src)
+
+	for i := 0; i < d.NumField(); i++ {
+		field := d.Field(i)
+
+		if field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			field.Set(s.Field(i))
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"reelix-go/internal/db"
+)
+
+// PruneReport lists what was removed from the database because it no
+// longer exists on disk.
+type PruneReport struct {
+	Vaults      []string `json:"vaults"`
+	Collections []string `json:"collections"`
+	Videos      []string `json:"videos"`
+	Galleries   []string `json:"galleries"`
+	Tags        []string `json:"tags"`
+	Actors      []string `json:"actors"`
+}
+
+func (r PruneReport) String() string {
+	return fmt.Sprintf(
+		"%d vaults, %d collections, %d videos, %d galleries, %d tags, %d actors",
+		len(r.Vaults),
+		len(r.Collections),
+		len(r.Videos),
+		len(r.Galleries),
+		len(r.Tags),
+		len(r.Actors),
+	)
+}
+
+// Reconcile removes everything from the database that is not part of the
+// scanned world. It should only be given a world from a successful Scan,
+// and parts of a vault that could not be read are left untouched. Nothing
+// is removed unless everything that has to be can be.
+func Reconcile(ctx context.Context, world World, store db.Store) (PruneReport, error) {
+	var report PruneReport
+
+	err := store.InTx(ctx, func(tx db.Store) error {
+		vaultNames := make([]string, 0, len(world.Vaults))
+
+		for _, v := range world.Vaults {
+			vaultNames = append(vaultNames, v.Vault.Name)
+		}
+
+		pruned, err := tx.DeleteVaultsExcept(ctx, vaultNames)
+
+		if err != nil {
+			return err
+		}
+
+		report.Vaults = pruned
+
+		for _, v := range world.Vaults {
+			if err := reconcileVault(ctx, v, &report, tx); err != nil {
+				return err
+			}
+		}
+
+		return pruneOrphans(ctx, world, &report, tx)
+	})
+
+	if err != nil {
+		return PruneReport{}, err
+	}
+
+	return report, nil
+}
+
+func reconcileVault(ctx context.Context, v VaultState, report *PruneReport, store db.Store) error {
+	dbVault, err := store.GetVaultByName(ctx, v.Vault.Name)
+
+	if err != nil {
+		// A vault that never made it into the database has
+		// nothing to prune.
+		return nil
+	}
+
+	if v.collectionsScanned {
+		names := make([]string, 0, len(v.Collections))
+
+		for _, c := range v.Collections {
+			names = append(names, c.Collection.Name)
+		}
+
+		pruned, err := store.DeleteCollectionsExcept(ctx, dbVault.ID, names)
+
+		if err != nil {
+			return err
+		}
+
+		report.Collections = append(report.Collections, pruned...)
+	}
+
+	for _, c := range v.Collections {
+		if err := reconcileCollection(ctx, dbVault.ID, c, report, store); err != nil {
+			return err
+		}
+	}
+
+	if v.galleriesScanned {
+		slugs := make([]string, 0, len(v.Galleries))
+
+		for _, g := range v.Galleries {
+			slugs = append(slugs, g.Slug)
+		}
+
+		kept := slices.Concat(v.skippedGalleries, v.unchangedGalleries)
+
+		if err := reconcileGalleries(ctx, dbVault.ID, slugs, kept, report, store); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reconcileCollection(ctx context.Context, vaultID int, c CollectionState, report *PruneReport, store db.Store) error {
+	if !c.videosScanned {
+		return nil
+	}
+
+	slugs := make([]string, 0, len(c.Videos)+len(c.skippedVideos)+len(c.unchangedVideos))
+
+	for _, video := range c.Videos {
+		slugs = append(slugs, video.Slug)
+	}
+
+	slugs = append(slugs, c.skippedVideos...)
+	slugs = append(slugs, c.unchangedVideos...)
+
+	pruned, err := store.DeleteVideosExcept(ctx, vaultID, c.Collection.Name, slugs)
+
+	if err != nil {
+		return err
+	}
+
+	report.Videos = append(report.Videos, pruned...)
+
+	return nil
+}
+
+// reconcileGalleries removes the galleries of a vault that are not in
+// slugs. Skipped galleries are kept along with everything nested in them.
+func reconcileGalleries(ctx context.Context, vaultID int, slugs []string, skipped []string, report *PruneReport, store db.Store) error {
+	pruned, err := store.DeleteGalleriesExcept(ctx, vaultID, slugs, skipped)
+
+	if err != nil {
+		return err
+	}
+
+	report.Galleries = append(report.Galleries, pruned...)
+
+	return nil
+}
+
+// pruneOrphans removes tags without videos and actors that neither appear
+// in a video nor have a photo in any vault. Actors are shared between
+// vaults, so they are only pruned when every vault's photos were read.
+func pruneOrphans(ctx context.Context, world World, report *PruneReport, store db.Store) error {
+	tags, err := store.DeleteOrphanTags(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	report.Tags = append(report.Tags, tags...)
+
+	var actorSlugs []string
+
+	for _, v := range world.Vaults {
+		if !v.actorsScanned {
+			return nil
+		}
+
+		for _, a := range v.Actors {
+			actorSlugs = append(actorSlugs, a.Slug)
+		}
+
+		actorSlugs = append(actorSlugs, v.unchangedActors...)
+	}
+
+	actors, err := store.DeleteOrphanActors(ctx, actorSlugs)
+
+	if err != nil {
+		return err
+	}
+
+	report.Actors = append(report.Actors, actors...)
+
+	return nil
+}
+
+// scanAllActors lists the actors of every vault of the library, which is
+// all that pruning needs to know about them.
+func scanAllActors(library Library) (World, error) {
+	ig := newIgnorer(library.paths()...)
+	vaults, err := library.vaults(ig)
+
+	if err != nil {
+		return World{}, err
+	}
+
+	world := World{}
+
+	for _, vault := range vaults {
+		files, err := listActors(vault.actors, ig)
+
+		var actors []db.Actor
+
+		for _, f := range files {
+			actors = append(actors, db.Actor{Slug: f.slug})
+		}
+
+		world.Vaults = append(world.Vaults, VaultState{
+			Vault:         db.Vault{Name: vault.name},
+			Actors:        actors,
+			actorsScanned: scanned(err),
+		})
+	}
+
+	return world, nil
+}
@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"reelix-go/internal/db"
+)
+
+const (
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// ScanReport collects the problems found while scanning the library so a
+// single broken folder doesn't stop everything else from being scanned.
+type ScanReport struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Issues     []db.ScanIssue `json:"issues"`
+
+	mu sync.Mutex
+}
+
+func newScanReport() *ScanReport {
+	return &ScanReport{StartedAt: time.Now()}
+}
+
+// warn records something that was skipped but is not necessarily wrong,
+// like a folder without metadata.
+func (r *ScanReport) warn(path string, format string, args ...any) {
+	r.add(path, severityWarning, fmt.Sprintf(format, args...))
+}
+
+// fail records something that could not be read or parsed.
+func (r *ScanReport) fail(path string, err error) {
+	r.add(path, severityError, err.Error())
+}
+
+func (r *ScanReport) add(path string, severity string, message string) {
+	log.Printf("scan %v: %v (%v)", severity, message, path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Issues = append(r.Issues, db.ScanIssue{
+		Path:     path,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+func (r *ScanReport) finish() {
+	r.FinishedAt = time.Now()
+}
@@ -1,15 +1,28 @@
 package scanner
 
 import (
-	"encoding/xml"
+	"context"
+	"errors"
 	"fmt"
+	goimage "image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"reelix-go/internal/db"
 	"reelix-go/internal/utils"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type World struct {
@@ -21,152 +34,704 @@ type VaultState struct {
 	Collections []CollectionState
 	Galleries   []db.Gallery
 	Actors      []db.Actor
+
+	// Only the parts of a vault that were read completely can be
+	// trusted when pruning what is no longer on disk.
+	actorsScanned      bool
+	galleriesScanned   bool
+	collectionsScanned bool
+
+	// Galleries that exist but could not be read are kept
+	// in the database as they are.
+	skippedGalleries []string
+
+	// Galleries and actors that haven't changed since they were
+	// last read aren't read again, and are kept as they are too.
+	unchangedGalleries []string
+	unchangedActors    []string
 }
 
 type CollectionState struct {
 	Collection db.Collection
 	Videos     []db.Video
+
+	videosScanned bool
+
+	// Video folders that exist but could not be read are kept
+	// in the database as they are.
+	skippedVideos []string
+
+	// Video folders that haven't changed since they were last read
+	// aren't read again, and are kept as they are too.
+	unchangedVideos []string
+}
+
+// Options controls how the library is scanned.
+type Options struct {
+	// Workers is how many directories and metadata files are read at
+	// the same time. Zero or less uses one worker per CPU.
+	Workers int
+
+	// FullHash hashes the whole content of every file on top of its
+	// oshash fingerprint. It reads the entire library, so it is off
+	// by default.
+	FullHash bool
+
+	// Providers is the chain video metadata is read with. Nil uses
+	// DefaultProviders.
+	Providers []MetadataProvider
+
+	// SkipUnchanged leaves out the actors folders, galleries,
+	// collections and video folders that haven't changed since the scan
+	// state saved with them in the database. Changing FullHash or
+	// Providers counts as a change. Scan states are only taken when it
+	// is set, so a full scan leaves the saved ones as they are.
+	SkipUnchanged bool
+}
+
+// scanRun holds what every step of a single scan shares.
+type scanRun struct {
+	ctx       context.Context
+	library   Library
+	workers   int
+	fullHash  bool
+	skip      bool
+	providers []MetadataProvider
+	report    *ScanReport
+	ignore    *ignorer
+
+	// store has the scan states that unchanged folders are
+	// recognised by.
+	store db.Store
+
+	// stateKey is part of the scan state of video folders and
+	// collections, which are read differently when the options
+	// they are read with change.
+	stateKey string
 }
 
-func Scan(root string) (World, error) {
+func newScanRun(ctx context.Context, library Library, opts Options, report *ScanReport, store db.Store) *scanRun {
+	workers := opts.Workers
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	providers := opts.Providers
+
+	if providers == nil {
+		providers = DefaultProviders()
+	}
+
+	return &scanRun{
+		ctx:       ctx,
+		library:   library,
+		workers:   workers,
+		fullHash:  opts.FullHash,
+		skip:      opts.SkipUnchanged,
+		providers: providers,
+		report:    report,
+		ignore:    newIgnorer(library.paths()...),
+		store:     store,
+		stateKey:  fmt.Sprintf("%v\x00%v", opts.FullHash, providersKey(providers)),
+	}
+}
+
+// each calls fn for every index below n on at most s.workers goroutines
+// and waits for all of them to finish. Callers store results by index,
+// which keeps the output in the same order however the work was scheduled.
+func (s *scanRun) each(n int, fn func(i int)) error {
+	g, ctx := errgroup.WithContext(s.ctx)
+	g.SetLimit(s.workers)
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		g.Go(func() error {
+			fn(i)
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	return s.ctx.Err()
+}
+
+// Scan reads the library. Problems with individual items are collected
+// in the returned report and only an unreadable library or a cancelled
+// context fails the whole scan. Nothing is written to store, it is only
+// asked which folders are unchanged.
+func Scan(ctx context.Context, library Library, opts Options, store db.Store) (World, *ScanReport, error) {
 	world := World{}
+	report := newScanReport()
+
+	defer report.finish()
 
-	vaults, err := scanVaults(root)
+	run := newScanRun(ctx, library, opts, report, store)
+	vaults, err := library.vaults(run.ignore)
 
 	if err != nil {
-		return world, err
+		failedPath := strings.Join(library.paths(), ", ")
+
+		var pathErr *fs.PathError
+
+		if errors.As(err, &pathErr) {
+			failedPath = pathErr.Path
+		}
+
+		report.fail(failedPath, err)
+		return world, report, err
+	}
+
+	world.Vaults, err = run.vaults(vaults)
+
+	if err != nil {
+		return world, report, err
+	}
+
+	return world, report, nil
+}
+
+// vaults scans the actors, galleries and collections of every vault.
+// Each level of the library is read in parallel before moving on to
+// the next one.
+func (s *scanRun) vaults(vaults []vaultLayout) ([]VaultState, error) {
+	states := make([]VaultState, len(vaults))
+	galleryNames := make([][]string, len(vaults))
+	galleryStates := make([]map[string]db.ScanState, len(vaults))
+	collections := make([][]db.Collection, len(vaults))
+
+	for i, vault := range vaults {
+		states[i].Vault = db.Vault{Name: vault.name}
+	}
+
+	// The actors, galleries and collections of a vault live in
+	// separate directories, so all three are listed at once.
+	err := s.each(len(vaults)*3, func(i int) {
+		v := i / 3
+		state := &states[v]
+		layout := vaults[v]
+
+		switch i % 3 {
+		case 0:
+			err := s.vaultActors(state, layout.actors)
+			state.actorsScanned = scanned(err)
+
+			if !state.actorsScanned {
+				s.report.fail(layout.actors, err)
+			}
+
+		case 1:
+			names, err := listGalleries(layout.pictures, layout.actors, s.ignore)
+			galleryNames[v] = names
+			state.galleriesScanned = scanned(err)
+
+			if !state.galleriesScanned {
+				s.report.fail(layout.pictures, err)
+				return
+			}
+
+			galleryStates[v] = s.scanStates(layout.pictures)
+
+		case 2:
+			cs, err := scanCollections(layout.videos, s.ignore)
+			collections[v] = cs
+			state.collectionsScanned = scanned(err)
+
+			if !state.collectionsScanned {
+				s.report.fail(layout.videos, err)
+			}
+		}
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	for _, vault := range vaults {
-		vaultState := VaultState{Vault: vault}
+	type galleryJob struct {
+		vault int
+		name  string
+	}
 
-		vaultVideosPath := filepath.Join(root, "vaults", vault.Name, "videos")
-		vaultPicturesPath := filepath.Join(root, "vaults", vault.Name, "pictures")
+	var galleryJobs []galleryJob
 
-		actors, _ := scanActors(vaultPicturesPath)
-		vaultState.Actors = actors
+	for v, names := range galleryNames {
+		for _, name := range names {
+			galleryJobs = append(galleryJobs, galleryJob{vault: v, name: name})
+		}
+	}
 
-		galleries, _ := scanGalleries(vaultPicturesPath)
-		vaultState.Galleries = galleries
+	galleries := make([][]db.Gallery, len(galleryJobs))
+	skippedGalleries := make([][]string, len(galleryJobs))
+	unchangedGalleries := make([]bool, len(galleryJobs))
 
-		collections, _ := scanCollections(vaultVideosPath)
+	err = s.each(len(galleryJobs), func(i int) {
+		job := galleryJobs[i]
+		picturePath := vaults[job.vault].pictures
 
-		for _, c := range collections {
-			cs := CollectionState{Collection: c}
+		// The state is taken before reading, so anything that
+		// changes while we read is picked up by the next scan.
+		var state *db.ScanState
 
-			collectionPath := filepath.Join(vaultVideosPath, c.Slug)
+		if s.skip {
+			var err error
+			state, err = s.galleryState(picturePath, job.name)
 
-			videos, err := scanVideos(collectionPath)
 			if err != nil {
-				log.Println("video scan error:", err)
-				continue
+				s.report.warn(filepath.Join(picturePath, job.name), "failed to read scan state: %v", err)
 			}
+		}
+
+		if isUnchanged(galleryStates[job.vault], state) {
+			unchangedGalleries[i] = true
+			return
+		}
+
+		tree, skipped, err := s.gallery(picturePath, job.name)
+
+		if err != nil {
+			s.report.fail(filepath.Join(picturePath, job.name), err)
+			skipped = []string{job.name}
+		}
+
+		// A gallery with nested galleries that could not be read
+		// has to be read again, so its state isn't saved.
+		if len(tree) > 0 && len(skipped) == 0 {
+			tree[0].ScanState = state
+		}
+
+		galleries[i] = tree
+		skippedGalleries[i] = skipped
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Galleries that exist but could not be read are remembered
+	// so neither they nor the galleries nested in them are pruned.
+	for i, job := range galleryJobs {
+		state := &states[job.vault]
+
+		if unchangedGalleries[i] {
+			state.unchangedGalleries = append(state.unchangedGalleries, job.name)
+			continue
+		}
 
-			cs.Videos = videos
-			vaultState.Collections = append(vaultState.Collections, cs)
+		state.Galleries = append(state.Galleries, galleries[i]...)
+		state.skippedGalleries = append(state.skippedGalleries, skippedGalleries[i]...)
+	}
+
+	for _, state := range states {
+		if n := len(state.unchangedGalleries); n > 0 {
+			log.Printf("skipped %v unchanged galleries (vault: %v)", n, state.Vault.Name)
 		}
+	}
+
+	var allCollections []db.Collection
+	var owners []int
 
-		world.Vaults = append(world.Vaults, vaultState)
+	for v, cs := range collections {
+		for _, c := range cs {
+			allCollections = append(allCollections, c)
+			owners = append(owners, v)
+		}
 	}
 
-	return world, nil
+	collectionStates, err := s.collections(allCollections)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The collection is kept even when its videos could not be read
+	// so it is not mistaken for one that was deleted.
+	for i, cs := range collectionStates {
+		states[owners[i]].Collections = append(states[owners[i]].Collections, cs)
+	}
+
+	return states, nil
 }
 
-func scanVaults(rootPath string) ([]db.Vault, error) {
-	vaultsPath := filepath.Join(rootPath, "vaults")
-	entries, err := os.ReadDir(vaultsPath)
+// collections reads the video folders of every collection.
+func (s *scanRun) collections(collections []db.Collection) ([]CollectionState, error) {
+	states := make([]CollectionState, len(collections))
+	folders := make([][]string, len(collections))
+	scanStates := make([]map[string]db.ScanState, len(collections))
+	collectionStates := make([]*db.ScanState, len(collections))
+	folderStates := make([][]*db.ScanState, len(collections))
+
+	for i, c := range collections {
+		states[i].Collection = c
+	}
+
+	err := s.each(len(collections), func(i int) {
+		names, err := listVideoFolders(collections[i].Path, s.ignore)
+
+		if err != nil {
+			s.report.fail(collections[i].Path, err)
+			return
+		}
+
+		states[i].videosScanned = true
+		folders[i] = names
+
+		if !s.skip {
+			return
+		}
+
+		// The state is taken before reading, so anything that
+		// changes while we read is picked up by the next scan.
+		// Without it every folder is simply read.
+		state, folderState, err := s.collectionState(collections[i].Path, names)
+
+		if err != nil {
+			s.report.warn(collections[i].Path, "failed to read scan state: %v", err)
+			return
+		}
+
+		scanStates[i] = s.scanStates(collections[i].Path)
+
+		// None of the folders of an unchanged collection have
+		// changed either.
+		if isUnchanged(scanStates[i], state) {
+			states[i].unchangedVideos = names
+			folders[i] = nil
+			return
+		}
+
+		collectionStates[i] = state
+		folderStates[i] = folderState
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to read vault: %w", err)
+		return nil, err
 	}
 
-	var vaults []db.Vault
+	type videoJob struct {
+		collection int
+		folder     string
+		state      *db.ScanState
+	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			vaults = append(vaults, db.Vault{
-				Name: entry.Name(),
-			})
+	var videoJobs []videoJob
+
+	for c, names := range folders {
+		for f, name := range names {
+			job := videoJob{collection: c, folder: name}
+
+			if folderStates[c] != nil {
+				job.state = folderStates[c][f]
+			}
 
-			log.Printf("vaults: %v", vaults)
+			videoJobs = append(videoJobs, job)
 		}
 	}
 
-	return vaults, nil
+	videos := make([]*db.Video, len(videoJobs))
+	unchangedVideos := make([]bool, len(videoJobs))
+
+	err = s.each(len(videoJobs), func(i int) {
+		job := videoJobs[i]
+
+		if isUnchanged(scanStates[job.collection], job.state) {
+			unchangedVideos[i] = true
+			return
+		}
+
+		if video, ok := s.video(collections[job.collection].Path, job.folder); ok {
+			video.ScanState = job.state
+			videos[i] = &video
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, job := range videoJobs {
+		state := &states[job.collection]
+
+		if unchangedVideos[i] {
+			state.unchangedVideos = append(state.unchangedVideos, job.folder)
+			continue
+		}
+
+		// Video folders that exist but could not be read are
+		// remembered so they aren't pruned.
+		if videos[i] == nil {
+			state.skippedVideos = append(state.skippedVideos, job.folder)
+			continue
+		}
+
+		state.Videos = append(state.Videos, *videos[i])
+	}
+
+	// A collection with video folders that could not be read has to
+	// be read again, so its state isn't saved.
+	for i := range states {
+		if len(states[i].skippedVideos) == 0 {
+			states[i].Collection.ScanState = collectionStates[i]
+		}
+	}
+
+	for _, state := range states {
+		if n := len(state.unchangedVideos); n > 0 {
+			log.Printf("skipped %v unchanged videos (collection: %v)", n, state.Collection.Name)
+		}
+	}
+
+	return states, nil
 }
 
-func scanGalleries(picturePath string) ([]db.Gallery, error) {
+// scanned reports whether a directory was read completely. A directory
+// that does not exist simply has nothing in it.
+func scanned(err error) bool {
+	return err == nil || errors.Is(err, fs.ErrNotExist)
+}
+
+// listGalleries returns the names of the gallery folders and archives
+// under picturePath, leaving out the actors folder if it is in there.
+func listGalleries(picturePath string, actorsPath string, ig *ignorer) ([]string, error) {
 	entries, err := os.ReadDir(picturePath)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to read collection: %w", err)
+		return nil, fmt.Errorf("failed to read galleries: %w", err)
 	}
 
-	var galleries []db.Gallery
+	var names []string
 
 	for _, entry := range entries {
-		if entry.IsDir() {
-			galleryName := entry.Name()
+		if ig.skip(picturePath, entry) {
+			continue
+		}
+
+		galleryName := entry.Name()
 
+		if entry.IsDir() {
 			// We ignore the actors/ folder as there
 			// is a separate scanning/syncing flow for actors.
-			if galleryName == "actors" {
+			if filepath.Join(picturePath, galleryName) == actorsPath {
 				continue
 			}
 
-			galleryPath := filepath.Join(picturePath, galleryName)
-			galleryEntries, err := os.ReadDir(galleryPath)
+			names = append(names, galleryName)
+		} else if isArchive(galleryName) {
+			names = append(names, galleryName)
+		}
+	}
+
+	return names, nil
+}
+
+// gallery reads a gallery folder or archive along with every gallery
+// nested in it, the gallery itself first. Nested galleries that could not
+// be read are returned as skipped slugs.
+func (s *scanRun) gallery(picturePath string, galleryName string) ([]db.Gallery, []string, error) {
+	return s.galleryTree(picturePath, galleryName, "")
+}
+
+func (s *scanRun) galleryTree(dir string, name string, parentSlug string) ([]db.Gallery, []string, error) {
+	slug := name
+
+	if parentSlug != "" {
+		slug = parentSlug + "/" + slug
+	}
+
+	if isArchive(name) {
+		gallery, err := s.archive(dir, name)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		gallery.Slug = slug
+		gallery.ParentSlug = parentSlug
+		gallery.TotalImageCount = gallery.ImageCount
+
+		return []db.Gallery{gallery}, nil, nil
+	}
+
+	galleryPath := filepath.Join(dir, name)
+	galleryEntries, err := os.ReadDir(galleryPath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var images []db.GalleryImage
+	var children []db.Gallery
+	var skipped []string
+
+	for _, galleryEntry := range galleryEntries {
+		if s.ignore.skip(galleryPath, galleryEntry) {
+			continue
+		}
+
+		entryPath := filepath.Join(galleryPath, galleryEntry.Name())
+
+		if galleryEntry.IsDir() || isArchive(galleryEntry.Name()) {
+			nested, nestedSkipped, err := s.galleryTree(galleryPath, galleryEntry.Name(), slug)
 
 			if err != nil {
-				return nil, err
+				s.report.fail(entryPath, err)
+				skipped = append(skipped, slug+"/"+galleryEntry.Name())
+				continue
 			}
 
-			galleryImageCount := 0
+			children = append(children, nested...)
+			skipped = append(skipped, nestedSkipped...)
+			continue
+		}
 
-			for _, galleryEntry := range galleryEntries {
-				if !galleryEntry.IsDir() {
-					galleryImageCount++
-				}
-			}
+		if !isImage(galleryEntry.Name()) {
+			continue
+		}
 
-			galleries = append(galleries, db.Gallery{
-				Title:      utils.SnakeToTitle(galleryName),
-				Slug:       galleryName,
-				ImageCount: galleryImageCount,
-			})
+		image, err := s.image(entryPath)
+
+		if err != nil {
+			s.report.warn(entryPath, "failed to read image: %v", err)
+			continue
 		}
+
+		images = append(images, image)
 	}
 
-	return galleries, nil
+	sortImages(images)
+
+	gallery := db.Gallery{
+		Title:           utils.SnakeToTitle(filepath.Base(name)),
+		Slug:            slug,
+		ParentSlug:      parentSlug,
+		Path:            galleryPath,
+		ImageCount:      len(images),
+		TotalImageCount: len(images),
+		Images:          images,
+	}
+
+	// Every gallery in children is nested somewhere below this one,
+	// but only the direct children add their totals.
+	for _, child := range children {
+		if child.ParentSlug == slug {
+			gallery.TotalImageCount += child.TotalImageCount
+		}
+	}
+
+	return append([]db.Gallery{gallery}, children...), skipped, nil
 }
 
-func scanActors(path string) ([]db.Actor, error) {
-	actorsPath := filepath.Join(path, "actors")
-	entries, err := os.ReadDir(actorsPath)
+// sortImages puts images in the natural order of their names.
+func sortImages(images []db.GalleryImage) {
+	sort.Slice(images, func(i, j int) bool {
+		return utils.NaturalLess(images[i].Filename, images[j].Filename)
+	})
 
-	log.Printf("path %v", actorsPath)
+	for i := range images {
+		images[i].SortOrder = i
+	}
+}
+
+// image reads the size, dimensions and hashes of an image file.
+func (s *scanRun) image(imagePath string) (db.GalleryImage, error) {
+	f, err := os.Open(imagePath)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to read actors: %w", err)
+		return db.GalleryImage{}, err
 	}
 
-	var actors []db.Actor
+	defer f.Close()
 
-	for _, entry := range entries {
-		actor := strings.TrimSuffix(entry.Name(), ".jpg")
+	stat, err := f.Stat()
+
+	if err != nil {
+		return db.GalleryImage{}, err
+	}
 
-		log.Printf("scanned actor: %v", actor)
+	image := db.GalleryImage{
+		Filename: filepath.Base(imagePath),
+		Size:     stat.Size(),
+		Format:   imageFormat(imagePath),
+	}
 
-		actors = append(actors, db.Actor{
-			Name: utils.SnakeToTitle(actor),
-			Slug: actor,
-		})
+	s.decodeImage(&image, f, imagePath)
+
+	image.OSHash, image.SHA256 = s.hash(imagePath)
+
+	return image, nil
+}
+
+// decodeImage reads the dimensions and EXIF metadata of an image. Formats
+// the standard library can't decode keep their extension as format and
+// no dimensions. path is only used to report problems.
+func (s *scanRun) decodeImage(image *db.GalleryImage, r io.ReadSeeker, path string) {
+	config, format, err := goimage.DecodeConfig(r)
+
+	switch {
+	case err == nil:
+		image.Width = config.Width
+		image.Height = config.Height
+		image.Format = format
+
+	case !errors.Is(err, goimage.ErrFormat):
+		s.report.warn(path, "failed to decode image header: %v", err)
+	}
+
+	if image.Format != "jpeg" {
+		return
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		s.report.warn(path, "failed to read exif: %v", err)
+		return
+	}
+
+	exif, err := decodeEXIF(r)
+
+	switch {
+	case err == nil:
+		image.EXIF = exif
+
+	case !errors.Is(err, errNoEXIF):
+		s.report.warn(path, "failed to read exif: %v", err)
 	}
+}
 
-	return actors, nil
+// imageExtensions are the files in a gallery that are indexed as images.
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+	".heic": true,
+	".avif": true,
 }
 
-func scanCollections(vaultPath string) ([]db.Collection, error) {
+func isImage(fileName string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// imageFormat guesses the format of an image from its extension, named
+// the way image.DecodeConfig names them.
+func imageFormat(fileName string) string {
+	switch ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), "."); ext {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	default:
+		return ext
+	}
+}
+
+func scanCollections(vaultPath string, ig *ignorer) ([]db.Collection, error) {
 	entries, err := os.ReadDir(vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read vault: %w", err)
@@ -175,7 +740,7 @@ func scanCollections(vaultPath string) ([]db.Collection, error) {
 	var collections []db.Collection
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !ig.skip(vaultPath, entry) {
 			name := entry.Name()
 
 			collections = append(collections, db.Collection{
@@ -183,66 +748,105 @@ func scanCollections(vaultPath string) ([]db.Collection, error) {
 				Slug: name,
 				Path: filepath.Join(vaultPath, name),
 			})
-
-			log.Printf("collections: %v", collections)
 		}
 	}
 	return collections, nil
 }
 
-func scanVideos(collectionPath string) ([]db.Video, error) {
+// listVideoFolders returns the names of the video folders in a collection.
+func listVideoFolders(collectionPath string, ig *ignorer) ([]string, error) {
 	entries, err := os.ReadDir(collectionPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read collection: %w", err)
 	}
 
-	var videos []db.Video
+	var names []string
 
 	for _, entry := range entries {
-		if entry.IsDir() {
-			folderName := entry.Name()
-			nfoPath := filepath.Join(collectionPath, folderName, folderName+".nfo")
+		if entry.IsDir() && !ig.skip(collectionPath, entry) {
+			names = append(names, entry.Name())
+		}
+	}
 
-			if _, err := os.Stat(nfoPath); err != nil {
-				return nil, fmt.Errorf("missing .nfo file for folder %v", folderName)
-			}
+	return names, nil
+}
 
-			metadata, err := parseNfoFile(nfoPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse .nfo for %v: %w", folderName, err)
-			}
+// video reads a single video folder. Folders without usable metadata are
+// reported and skipped so the rest of the collection is still scanned.
+func (s *scanRun) video(collectionPath string, folderName string) (db.Video, bool) {
+	folderPath := filepath.Join(collectionPath, folderName)
 
-			videos = append(videos, db.Video{
-				Title:  metadata.Title,
-				Slug:   folderName,
-				Studio: metadata.Studio,
-				Tags:   metadata.Tags,
-				Actors: metadata.Actors,
-			})
-		}
+	video, ok := s.metadata(folderPath, folderName)
+
+	if !ok {
+		return db.Video{}, false
 	}
 
-	return videos, nil
-}
+	if video.Premiered != "" {
+		if _, err := time.Parse(time.DateOnly, video.Premiered); err != nil {
+			s.report.warn(folderPath, "ignoring invalid premiered date %q", video.Premiered)
+			video.Premiered = ""
+		}
+	}
 
-type VideoMetadata struct {
-	Title  string     `xml:"title"`
-	Studio string     `xml:"studio"`
-	Tags   []string   `xml:"tag"`
-	Actors []db.Actor `xml:"actor"`
-}
+	files, err := scanVideoFiles(s.library, folderPath, s.ignore)
 
-func parseNfoFile(nfoPath string) (VideoMetadata, error) {
-	data, err := os.ReadFile(nfoPath)
 	if err != nil {
-		return VideoMetadata{}, err
+		s.report.fail(folderPath, err)
+	}
+
+	for i := range files {
+		files[i].OSHash, files[i].SHA256 = s.hash(filepath.Join(folderPath, path.Base(files[i].Path)))
 	}
 
-	var metadata VideoMetadata
-	err = xml.Unmarshal(data, &metadata)
+	video.Files = files
+	video.Media = s.media(folderPath, files)
+
+	subtitles, err := scanSubtitles(folderPath, folderName, files, s.ignore)
+
 	if err != nil {
-		return VideoMetadata{}, err
+		s.report.warn(folderPath, "failed to list subtitles: %v", err)
+	}
+
+	video.Subtitles = subtitles
+	video.PosterPath = findPoster(folderPath, folderName, s.ignore)
+
+	return video, true
+}
+
+// media probes the files of a video. Parts after the first only add to
+// the duration. A video without a file we can read still counts as a
+// video, just one we know less about.
+func (s *scanRun) media(folderPath string, files []db.VideoFile) *db.MediaInfo {
+	var info *db.MediaInfo
+	var size int64
+
+	for _, file := range files {
+		if !probeExtensions[strings.ToLower(filepath.Ext(file.Path))] {
+			continue
+		}
+
+		mediaPath := filepath.Join(folderPath, path.Base(file.Path))
+		partInfo, err := probeMedia(mediaPath)
+
+		if err != nil {
+			s.report.warn(mediaPath, "failed to probe media: %v", err)
+			continue
+		}
+
+		size += file.Size
+
+		if info == nil {
+			info = partInfo
+			continue
+		}
+
+		info.Duration += partInfo.Duration
+	}
+
+	if info != nil && info.Duration > 0 {
+		info.Bitrate = int64(float64(size*8) / info.Duration)
 	}
 
-	return metadata, nil
+	return info
 }
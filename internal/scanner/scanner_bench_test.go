@@ -0,0 +1,72 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"reelix-go/internal/db"
+)
+
+// buildLibrary writes a synthetic library with the given number of vaults,
+// collections per vault and videos per collection.
+func buildLibrary(b *testing.B, vaults, collections, videos int) string {
+	b.Helper()
+
+	root := b.TempDir()
+
+	for v := 0; v < vaults; v++ {
+		vaultPath := filepath.Join(root, "vaults", fmt.Sprintf("vault_%d", v))
+
+		for c := 0; c < collections; c++ {
+			collectionPath := filepath.Join(vaultPath, "videos", fmt.Sprintf("collection_%d", c))
+
+			for i := 0; i < videos; i++ {
+				slug := fmt.Sprintf("video_%d_%d_%d", v, c, i)
+				folderPath := filepath.Join(collectionPath, slug)
+
+				if err := os.MkdirAll(folderPath, 0o755); err != nil {
+					b.Fatal(err)
+				}
+
+				nfo := fmt.Sprintf(
+					"<movie><title>Video %d</title><studio>Studio %d</studio><tag>one</tag><tag>two</tag><actor><name>Actor %d</name></actor></movie>",
+					i, c, i%10,
+				)
+
+				if err := os.WriteFile(filepath.Join(folderPath, slug+".nfo"), []byte(nfo), 0o644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	return root
+}
+
+func BenchmarkScan(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	root := buildLibrary(b, 2, 10, 100)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				world, _, err := Scan(context.Background(), DefaultLibrary(root), Options{Workers: workers}, db.NewMemory())
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if len(world.Vaults) != 2 {
+					b.Fatalf("expected 2 vaults, got %d", len(world.Vaults))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"reelix-go/internal/db"
+)
+
+// folderState fingerprints a video folder, along with how its video is
+// read: the metadata providers and whether files are hashed in full.
+func (s *scanRun) folderState(folderPath string) (*db.ScanState, error) {
+	return s.dirState(folderPath, "video\x00"+s.stateKey, false)
+}
+
+// collectionState fingerprints a collection by the states of its video
+// folders, which are returned as well, so every folder is only looked at
+// once.
+func (s *scanRun) collectionState(collectionPath string, folders []string) (*db.ScanState, []*db.ScanState, error) {
+	state, err := s.dirState(collectionPath, "collection\x00"+s.stateKey, false)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(state.MetadataHash + "\x00"))
+
+	folderStates := make([]*db.ScanState, len(folders))
+
+	for i, name := range folders {
+		folderState, err := s.folderState(filepath.Join(collectionPath, name))
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		state.Size += folderState.Size
+
+		if folderState.ModTime.After(state.ModTime) {
+			state.ModTime = folderState.ModTime
+		}
+
+		h.Write([]byte(name + "\x00" + folderState.MetadataHash + "\x00"))
+		folderStates[i] = folderState
+	}
+
+	state.MetadataHash = hex.EncodeToString(h.Sum(nil))
+
+	return state, folderStates, nil
+}
+
+// galleryState fingerprints a top level gallery folder or archive along
+// with every gallery nested in it.
+func (s *scanRun) galleryState(picturePath string, galleryName string) (*db.ScanState, error) {
+	return s.dirState(filepath.Join(picturePath, galleryName), fmt.Sprintf("gallery\x00%v", s.fullHash), true)
+}
+
+// actorsState fingerprints the photos and .nfo files of an actors folder.
+func (s *scanRun) actorsState(actorsPath string) (*db.ScanState, error) {
+	return s.dirState(actorsPath, "actors", false)
+}
+
+// dirState fingerprints a directory without reading any file: the latest
+// mtime and the total size of its files, plus a hash of key and of the
+// names of the files. Nested directories are only included when
+// recursive. Ignored files are left out, so changing what is ignored
+// counts as a change. A single file, like a gallery archive, is
+// fingerprinted by itself.
+func (s *scanRun) dirState(dirPath string, key string, recursive bool) (*db.ScanState, error) {
+	info, err := os.Stat(dirPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := &db.ScanState{
+		Path:    dirPath,
+		ModTime: info.ModTime(),
+	}
+
+	h := sha256.New()
+	h.Write([]byte(key + "\x00"))
+
+	if info.IsDir() {
+		err = s.addDirState(state, h, dirPath, "", recursive)
+	} else {
+		state.Size = info.Size()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The database keeps microseconds, which is what we compare with.
+	state.ModTime = state.ModTime.Truncate(time.Microsecond)
+	state.MetadataHash = hex.EncodeToString(h.Sum(nil))
+
+	return state, nil
+}
+
+// addDirState adds the entries of dir, which is rel below the directory
+// being fingerprinted, to state and h.
+func (s *scanRun) addDirState(state *db.ScanState, h hash.Hash, dir string, rel string, recursive bool) error {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if (entry.IsDir() && !recursive) || s.ignore.skip(dir, entry) {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(state.ModTime) {
+			state.ModTime = info.ModTime()
+		}
+
+		name := path.Join(rel, entry.Name())
+		h.Write([]byte(name + "\x00"))
+
+		if entry.IsDir() {
+			if err := s.addDirState(state, h, filepath.Join(dir, entry.Name()), name, recursive); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		state.Size += info.Size()
+	}
+
+	return nil
+}
+
+// unchanged reports whether a folder looks the same as when it was read.
+func unchanged(previous db.ScanState, current db.ScanState) bool {
+	return previous.ModTime.Equal(current.ModTime) &&
+		previous.Size == current.Size &&
+		previous.MetadataHash == current.MetadataHash
+}
+
+// scanStates returns the saved scan states of the paths starting with dir,
+// or nil when unchanged folders aren't skipped. Without them every folder
+// is simply read.
+func (s *scanRun) scanStates(dir string) map[string]db.ScanState {
+	if !s.skip {
+		return nil
+	}
+
+	states, err := s.store.GetScanStates(s.ctx, dir)
+
+	if err != nil {
+		s.report.warn(dir, "failed to load scan state: %v", err)
+		return nil
+	}
+
+	return states
+}
+
+// isUnchanged reports whether state is known and matches the one saved
+// for its path in states.
+func isUnchanged(states map[string]db.ScanState, state *db.ScanState) bool {
+	if state == nil {
+		return false
+	}
+
+	previous, ok := states[state.Path]
+
+	return ok && unchanged(previous, *state)
+}
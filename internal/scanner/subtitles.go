@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"reelix-go/internal/db"
+
+	"golang.org/x/text/language"
+)
+
+// subtitleFormats maps the sidecar extensions we pick up to their format.
+var subtitleFormats = map[string]string{
+	".srt": "srt",
+	".vtt": "vtt",
+	".ass": "ass",
+	".ssa": "ssa",
+}
+
+// scanSubtitles lists the subtitle sidecars of a video folder. Sidecars
+// are named after the video, with dot separated flags and a language
+// before the extension, like "slug.en.srt" or "slug.forced.de.srt".
+func scanSubtitles(folderPath string, slug string, files []db.VideoFile, ig *ignorer) ([]db.Subtitle, error) {
+	entries, err := os.ReadDir(folderPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Sidecars can be named after the folder or after any of the files
+	// of a multi-part video.
+
+	prefixes := []string{slug}
+
+	for _, f := range files {
+		name := filepath.Base(f.Path)
+		prefixes = append(prefixes, strings.TrimSuffix(name, filepath.Ext(name)))
+	}
+
+	// Longest first, so "slug-cd1" wins over "slug".
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	var subtitles []db.Subtitle
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		format, ok := subtitleFormats[ext]
+
+		if entry.IsDir() || !ok || ig.skip(folderPath, entry) {
+			continue
+		}
+
+		subtitle := subtitleFromName(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), prefixes)
+		subtitle.Format = format
+		subtitle.Path = filepath.Join(folderPath, entry.Name())
+
+		subtitles = append(subtitles, subtitle)
+	}
+
+	return subtitles, nil
+}
+
+// subtitleFromName reads the language and flags from the name of a
+// sidecar without its extension.
+func subtitleFromName(base string, prefixes []string) db.Subtitle {
+	var tokens []string
+	matched := false
+
+	for _, prefix := range prefixes {
+		if base == prefix {
+			matched = true
+			break
+		}
+
+		if strings.HasPrefix(base, prefix+".") {
+			tokens = strings.Split(strings.TrimPrefix(base, prefix+"."), ".")
+			matched = true
+			break
+		}
+	}
+
+	// A sidecar named after neither the folder nor a file still gets
+	// its flags read, assuming the name ends at the first dot.
+	if !matched {
+		if i := strings.Index(base, "."); i >= 0 {
+			tokens = strings.Split(base[i+1:], ".")
+		}
+	}
+
+	var subtitle db.Subtitle
+	var labels []string
+
+	for _, token := range tokens {
+		switch strings.ToLower(token) {
+		case "forced", "foreign":
+			subtitle.Forced = true
+			continue
+
+		case "sdh", "cc", "hi":
+			subtitle.SDH = true
+			continue
+
+		case "default":
+			subtitle.Default = true
+			continue
+
+		case "":
+			continue
+		}
+
+		if subtitle.Language == "" {
+			if lang, ok := subtitleLanguage(token); ok {
+				subtitle.Language = lang
+				continue
+			}
+		}
+
+		labels = append(labels, token)
+	}
+
+	subtitle.Label = strings.Join(labels, " ")
+
+	return subtitle
+}
+
+// subtitleLanguage recognises ISO 639 codes and BCP 47 tags such as "en",
+// "ger" or "pt-BR" and returns them as a BCP 47 tag.
+func subtitleLanguage(token string) (string, bool) {
+	if len(token) < 2 {
+		return "", false
+	}
+
+	tag, err := language.Parse(token)
+
+	if err != nil {
+		return "", false
+	}
+
+	return tag.String(), true
+}
@@ -1,73 +1,107 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 
 	"reelix-go/internal/db"
 )
 
-func Sync(world World) error {
+// Sync writes the world to the database. Every vault is synced in a
+// transaction of its own, so a vault that fails is rolled back as a whole
+// and doesn't keep the others from being synced. Once ctx is done the
+// vaults that are left are not synced.
+func Sync(ctx context.Context, world World, store db.Store) error {
+	var errs []error
+
 	for _, v := range world.Vaults {
-		dbVaults, err := SyncVaults([]db.Vault{v.Vault})
-		if err != nil {
-			log.Println("vault sync error:", err)
-			continue
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
 		}
 
-		vaultID := dbVaults[0].ID
+		err := store.InTx(ctx, func(tx db.Store) error {
+			return syncVault(ctx, v, tx)
+		})
 
-		if err := SyncActors(v.Actors); err != nil {
-			log.Println("actor sync error:", err)
+		if err != nil {
+			log.Printf("vault sync error, rolled back vault %v: %v", v.Vault.Name, err)
+			errs = append(errs, fmt.Errorf("vault %v: %w", v.Vault.Name, err))
 		}
+	}
 
-		for i := range v.Galleries {
-			v.Galleries[i].VaultID = vaultID
-		}
-		if err := SyncGalleries(v.Galleries); err != nil {
-			log.Println("gallery sync error:", err)
-		}
+	return errors.Join(errs...)
+}
 
-		var collectionsToSync []db.Collection
-		for _, c := range v.Collections {
-			c.Collection.VaultID = vaultID
-			collectionsToSync = append(collectionsToSync, c.Collection)
-		}
+func syncVault(ctx context.Context, v VaultState, store db.Store) error {
+	dbVaults, err := SyncVaults(ctx, []db.Vault{v.Vault}, store)
+	if err != nil {
+		return err
+	}
 
-		dbCollections, err := SyncCollections(collectionsToSync)
-		if err != nil {
-			log.Println("collection sync error:", err)
-			continue
-		}
+	vaultID := dbVaults[0].ID
+
+	if err := SyncActors(ctx, v.Actors, store); err != nil {
+		return err
+	}
 
-		// Since the name of a collection is unique we can
-		// map the name to its ID
+	for i := range v.Galleries {
+		v.Galleries[i].VaultID = vaultID
+	}
+	if err := SyncGalleries(ctx, v.Galleries, store); err != nil {
+		return err
+	}
 
-		collectionMap := map[string]int{}
+	var collectionsToSync []db.Collection
+	for _, c := range v.Collections {
+		c.Collection.VaultID = vaultID
+		collectionsToSync = append(collectionsToSync, c.Collection)
+	}
 
-		for _, c := range dbCollections {
-			collectionMap[c.Name] = c.ID
-		}
+	dbCollections, err := SyncCollections(ctx, collectionsToSync, store)
+	if err != nil {
+		return err
+	}
+
+	// Since the name of a collection is unique we can
+	// map the name to its ID
+
+	collectionMap := map[string]int{}
 
-		for _, c := range v.Collections {
+	for _, c := range dbCollections {
+		collectionMap[c.Name] = c.ID
+	}
+
+	for _, c := range v.Collections {
 
-			collectionID := collectionMap[c.Collection.Name]
+		collectionID := collectionMap[c.Collection.Name]
 
-			for i := range c.Videos {
-				c.Videos[i].CollectionID = collectionID
-			}
+		for i := range c.Videos {
+			c.Videos[i].CollectionID = collectionID
+		}
 
-			if err := SyncVideos(c.Videos); err != nil {
-				log.Println("video sync error:", err)
-			}
+		if err := SyncVideos(ctx, c.Videos, store); err != nil {
+			return err
 		}
 	}
 
+	// Tags that lost their last video along the way go with it.
+	tags, err := store.DeleteOrphanTags(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		log.Printf("removed unused tags: %v", tags)
+	}
+
 	return nil
 }
 
-func SyncVaults(vaults []db.Vault) ([]db.Vault, error) {
-	dbVaults, err := db.CreateVaults(vaults)
+func SyncVaults(ctx context.Context, vaults []db.Vault, store db.Store) ([]db.Vault, error) {
+	dbVaults, err := store.CreateVaults(ctx, vaults)
 
 	if err != nil {
 		return nil, fmt.Errorf("db vaults sync error: %v", err)
@@ -76,18 +110,39 @@ func SyncVaults(vaults []db.Vault) ([]db.Vault, error) {
 	return dbVaults, nil
 }
 
-func SyncGalleries(galleries []db.Gallery) error {
-	_, err := db.CreateGallery(galleries)
+func SyncGalleries(ctx context.Context, galleries []db.Gallery, store db.Store) error {
+	dbGalleries, err := store.CreateGallery(ctx, galleries)
 
 	if err != nil {
 		return fmt.Errorf("db galleries sync error: %v", err)
 	}
 
+	// Slugs are the gallery folder names, so they are unique
+	// within the vault being synced.
+
+	galleryMap := map[string]int{}
+
+	for _, g := range dbGalleries {
+		galleryMap[g.Slug] = g.ID
+	}
+
+	for _, g := range galleries {
+		galleryID, ok := galleryMap[g.Slug]
+
+		if !ok {
+			continue
+		}
+
+		if err := store.CreateGalleryImages(ctx, galleryID, g.Images); err != nil {
+			return fmt.Errorf("db gallery images sync error: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func SyncCollections(collections []db.Collection) ([]db.Collection, error) {
-	dbCollections, err := db.CreateCollections(collections)
+func SyncCollections(ctx context.Context, collections []db.Collection, store db.Store) ([]db.Collection, error) {
+	dbCollections, err := store.CreateCollections(ctx, collections)
 
 	if err != nil {
 		return nil, fmt.Errorf("db collections sync error: %v", err)
@@ -96,23 +151,42 @@ func SyncCollections(collections []db.Collection) ([]db.Collection, error) {
 	return dbCollections, nil
 }
 
-func SyncVideos(videos []db.Video) error {
+func SyncVideos(ctx context.Context, videos []db.Video, store db.Store) error {
+	if err := store.CreateVideos(ctx, videos); err != nil {
+		return fmt.Errorf("db videos sync error: %v", err)
+	}
+
 	for _, v := range videos {
-		err := db.CreateVideo(v)
+		log.Printf("synced video: %v (collection: %v)", v.Title, v.CollectionID)
+	}
 
-		if err != nil {
-			return fmt.Errorf("db videos sync error: %v", err)
-		}
+	return nil
+}
 
-		log.Printf("synced video: %v (collection: %v)", v.Title, v.CollectionID)
+func SyncReport(ctx context.Context, report *ScanReport, store db.Store) error {
+	issues := report.Issues
+
+	// A clean scan is stored as an empty list rather than null.
+	if issues == nil {
+		issues = []db.ScanIssue{}
+	}
+
+	_, err := store.CreateScanReport(ctx, db.ScanReport{
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Issues:     issues,
+	})
+
+	if err != nil {
+		return fmt.Errorf("db scan report sync error: %v", err)
 	}
 
 	return nil
 }
 
-func SyncActors(actors []db.Actor) error {
+func SyncActors(ctx context.Context, actors []db.Actor, store db.Store) error {
 	for _, a := range actors {
-		_, err := db.CreateActor(a)
+		_, err := store.CreateActor(ctx, a)
 
 		if err != nil {
 			return fmt.Errorf("db actors sync error: %v", err)
@@ -123,3 +197,14 @@ func SyncActors(actors []db.Actor) error {
 
 	return nil
 }
+
+// syncVaultID makes sure the vault exists and returns its ID.
+func syncVaultID(ctx context.Context, name string, store db.Store) (int, error) {
+	dbVaults, err := SyncVaults(ctx, []db.Vault{{Name: name}}, store)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return dbVaults[0].ID, nil
+}
@@ -0,0 +1,458 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"reelix-go/internal/db"
+)
+
+// writeTestFile writes data to path, creating the folders on the way.
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestVideo writes a video folder with an NFO crediting actor and
+// listing tags.
+func writeTestVideo(t *testing.T, collectionPath string, slug string, actor string, tags ...string) {
+	t.Helper()
+
+	nfo := fmt.Sprintf("<movie><title>%v</title><actor><name>%v</name></actor>", slug, actor)
+
+	for _, tag := range tags {
+		nfo += fmt.Sprintf("<tag>%v</tag>", tag)
+	}
+
+	nfo += "</movie>"
+
+	writeTestFile(t, filepath.Join(collectionPath, slug, slug+".nfo"), []byte(nfo))
+}
+
+// writeTestImage writes a tiny PNG.
+func writeTestImage(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 2, 1))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// buildTestLibrary writes a vault with a collection of two videos and a
+// gallery with a nested gallery, and returns the library root.
+func buildTestLibrary(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	vaultPath := filepath.Join(root, "vaults", "home")
+	moviesPath := filepath.Join(vaultPath, "videos", "movies")
+
+	writeTestVideo(t, moviesPath, "the_film", "Jane Doe", "drama", "classic")
+	writeTestVideo(t, moviesPath, "the_sequel", "John Roe", "drama", "sequel")
+
+	writeTestImage(t, filepath.Join(vaultPath, "pictures", "holiday", "beach.png"))
+	writeTestImage(t, filepath.Join(vaultPath, "pictures", "holiday", "day_two", "pier.png"))
+
+	return root
+}
+
+// scanAndSync scans the library at root into store the way a startup scan
+// does and returns what was pruned.
+func scanAndSync(t *testing.T, root string, store db.Store) PruneReport {
+	t.Helper()
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	ctx := context.Background()
+
+	world, _, err := Scan(ctx, DefaultLibrary(root), Options{Workers: 2, SkipUnchanged: true}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Sync(ctx, world, store); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Reconcile(ctx, world, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+// syncedVideos returns the videos in the only collection of the only
+// vault in store.
+func syncedVideos(t *testing.T, store db.Store) []db.Video {
+	t.Helper()
+
+	vaults, err := store.GetVaults(context.Background())
+
+	if err != nil || len(vaults) != 1 {
+		t.Fatalf("expected one vault, got %v (%v)", vaults, err)
+	}
+
+	collections, err := store.GetCollections(context.Background(), vaults[0].ID)
+
+	if err != nil || len(collections) != 1 {
+		t.Fatalf("expected one collection, got %v (%v)", collections, err)
+	}
+
+	videos, err := store.GetVideos(context.Background(), collections[0].ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return videos
+}
+
+// titles lists the titles of videos.
+func titles(videos []db.Video) string {
+	var titles []string
+
+	for _, v := range videos {
+		titles = append(titles, v.Title)
+	}
+
+	return fmt.Sprint(titles)
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+
+	scanAndSync(t, buildTestLibrary(t), store)
+
+	if videos := titles(syncedVideos(t, store)); videos != "[the_film the_sequel]" {
+		t.Errorf("unexpected videos %v", videos)
+	}
+
+	vault, err := store.GetVaultByName(ctx, "home")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actors, err := store.GetActors(ctx, vault.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actors) != 2 || actors[0].Name != "Jane Doe" || actors[1].Name != "John Roe" {
+		t.Errorf("unexpected actors %+v", actors)
+	}
+
+	galleries, err := store.GetGalleries(ctx, vault.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(galleries) != 1 || galleries[0].TotalImageCount != 2 || len(galleries[0].Children) != 1 {
+		t.Fatalf("unexpected galleries %+v", galleries)
+	}
+
+	images, total, err := store.GetGalleryImages(ctx, galleries[0].Children[0].ID, db.ImageQuery{Limit: 10, Sort: "name"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 1 || images[0].Filename != "pier.png" || images[0].Width != 2 {
+		t.Errorf("unexpected images %+v", images)
+	}
+}
+
+func TestSyncKeepsIDs(t *testing.T) {
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+
+	scanAndSync(t, root, store)
+	before := syncedVideos(t, store)
+
+	scanAndSync(t, root, store)
+	after := syncedVideos(t, store)
+
+	if len(before) != 2 || fmt.Sprint(before) != fmt.Sprint(after) {
+		t.Errorf("videos changed on a second sync:\n%+v\n%+v", before, after)
+	}
+}
+
+func TestScanReportsFoldersWithoutMetadata(t *testing.T) {
+	root := buildTestLibrary(t)
+	folderPath := filepath.Join(root, "vaults", "home", "videos", "movies", "Studio - Untitled (2020)")
+
+	writeTestFile(t, filepath.Join(folderPath, "untitled.mp4"), []byte("untitled"))
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	world, report, err := Scan(context.Background(), DefaultLibrary(root), Options{Workers: 2}, db.NewMemory())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The folder name still makes a video of it.
+	if videos := titles(world.Vaults[0].Collections[0].Videos); videos != "[Untitled the_film the_sequel]" {
+		t.Errorf("unexpected videos %v", videos)
+	}
+
+	var warned []string
+
+	for _, issue := range report.Issues {
+		if issue.Severity == severityWarning && issue.Path == folderPath {
+			warned = append(warned, issue.Message)
+		}
+	}
+
+	if fmt.Sprint(warned) != "[no metadata found, using the folder name]" {
+		t.Errorf("expected the folder without metadata to be reported, got %v", report.Issues)
+	}
+}
+
+func TestSyncKeepsCopiesInOtherCollections(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+	videosPath := filepath.Join(root, "vaults", "home", "videos")
+
+	writeTestVideo(t, filepath.Join(videosPath, "archive"), "the_film", "Jane Doe", "drama", "classic")
+
+	for _, collection := range []string{"movies", "archive"} {
+		writeTestFile(t, filepath.Join(videosPath, collection, "the_film", "the_film.mp4"), []byte("the same film"))
+	}
+
+	scanAndSync(t, root, store)
+
+	duplicates, err := store.GetDuplicates(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test images are copies of each other too.
+	var videos [][]db.DuplicateVideo
+
+	for _, d := range duplicates {
+		if len(d.Videos) > 0 {
+			videos = append(videos, d.Videos)
+		}
+	}
+
+	if len(videos) != 1 || len(videos[0]) != 2 {
+		t.Fatalf("expected both copies of the film in one group, got %+v", duplicates)
+	}
+
+	a, b := videos[0][0], videos[0][1]
+
+	if a.VideoID == b.VideoID || a.CollectionName == b.CollectionName {
+		t.Errorf("expected a video in each collection, got %+v and %+v", a, b)
+	}
+}
+
+func TestSyncRenamesActors(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+	actorsPath := filepath.Join(root, "vaults", "home", "pictures", "actors")
+
+	writeTestImage(t, filepath.Join(actorsPath, "jane_doe.png"))
+	writeTestFile(t, filepath.Join(actorsPath, "jane_doe.nfo"), []byte("<person><name>Jane Doe</name></person>"))
+
+	scanAndSync(t, root, store)
+
+	// Renaming the actor keeps them, along with their photo and videos.
+	writeTestFile(t, filepath.Join(actorsPath, "jane_doe.nfo"), []byte("<person><name>Jane DOE</name></person>"))
+
+	scanAndSync(t, root, store)
+
+	vault, err := store.GetVaultByName(ctx, "home")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actors, err := store.GetActors(ctx, vault.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actors) != 2 || actors[0].Name != "Jane DOE" || !actors[0].HasPhoto {
+		t.Fatalf("unexpected actors %+v", actors)
+	}
+
+	videos, err := store.GetActorVideos(ctx, actors[0].ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(videos) != 1 || videos[0].Title != "the_film" {
+		t.Errorf("expected the renamed actor to keep their video, got %+v", videos)
+	}
+}
+
+func TestScanSkipsUnchanged(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+	picturesPath := filepath.Join(root, "vaults", "home", "pictures")
+
+	writeTestImage(t, filepath.Join(picturesPath, "actors", "jane_doe.png"))
+
+	scanAndSync(t, root, store)
+
+	opts := Options{Workers: 2, SkipUnchanged: true}
+	world, _, err := Scan(ctx, DefaultLibrary(root), opts, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := world.Vaults[0]
+
+	if len(vault.Actors) != 0 || len(vault.Galleries) != 0 || len(vault.Collections[0].Videos) != 0 {
+		t.Errorf("unchanged folders were read again: %+v", vault)
+	}
+
+	// Nothing that was skipped is mistaken for gone.
+	report, err := Reconcile(ctx, world, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.String() != (PruneReport{}).String() {
+		t.Errorf("expected nothing to be pruned, got %v", report)
+	}
+
+	// A full scan reads everything again.
+	world, _, err = Scan(ctx, DefaultLibrary(root), Options{Workers: 2}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault = world.Vaults[0]
+
+	if len(vault.Actors) != 1 || len(vault.Galleries) != 2 || len(vault.Collections[0].Videos) != 2 {
+		t.Errorf("expected a full scan to read every folder, got %+v", vault)
+	}
+
+	// Reading videos with other providers counts as a change, and so
+	// does a change to a nested gallery.
+	opts.Providers = []MetadataProvider{NfoProvider{}}
+	writeTestImage(t, filepath.Join(picturesPath, "holiday", "day_two", "pier_2.png"))
+
+	world, _, err = Scan(ctx, DefaultLibrary(root), opts, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault = world.Vaults[0]
+
+	if videos := titles(vault.Collections[0].Videos); videos != "[the_film the_sequel]" {
+		t.Errorf("expected the videos to be read again, got %v", videos)
+	}
+
+	if len(vault.Galleries) != 2 || len(vault.Actors) != 0 {
+		t.Errorf("expected only the changed gallery to be read again, got %+v and %+v", vault.Galleries, vault.Actors)
+	}
+}
+
+func TestReconcilePrunesRemovedFolders(t *testing.T) {
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+
+	scanAndSync(t, root, store)
+
+	vaultPath := filepath.Join(root, "vaults", "home")
+
+	if err := os.RemoveAll(filepath.Join(vaultPath, "videos", "movies", "the_sequel")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(vaultPath, "pictures", "holiday", "day_two")); err != nil {
+		t.Fatal(err)
+	}
+
+	report := scanAndSync(t, root, store)
+
+	if fmt.Sprint(report.Videos) != "[the_sequel]" {
+		t.Errorf("expected the sequel to be pruned, got %v", report.Videos)
+	}
+
+	if fmt.Sprint(report.Galleries) != "[Day Two]" {
+		t.Errorf("expected the nested gallery to be pruned, got %v", report.Galleries)
+	}
+
+	// The sequel took its own tag and actor with it.
+	if fmt.Sprint(report.Tags) != "[sequel]" || fmt.Sprint(report.Actors) != "[John Roe]" {
+		t.Errorf("expected the sequel's tag and actor to be pruned, got %v and %v", report.Tags, report.Actors)
+	}
+
+	if videos := titles(syncedVideos(t, store)); videos != "[the_film]" {
+		t.Errorf("unexpected videos %v", videos)
+	}
+}
+
+func TestSyncStopsWhenCancelled(t *testing.T) {
+	store := db.NewMemory()
+	root := buildTestLibrary(t)
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	world, _, err := Scan(context.Background(), DefaultLibrary(root), Options{}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := Sync(ctx, world, store); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the sync to be cancelled, got %v", err)
+	}
+
+	if vaults, _ := store.GetVaults(context.Background()); len(vaults) != 0 {
+		t.Errorf("expected nothing to be synced, got %v", vaults)
+	}
+}
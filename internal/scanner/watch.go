@@ -0,0 +1,735 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"reelix-go/internal/db"
+	"reelix-go/internal/utils"
+)
+
+// Filesystems tend to emit events in bursts (a copy creates, writes and
+// closes many files), so we wait for the library to be quiet for a moment
+// before re-scanning what changed.
+const watchDebounce = 2 * time.Second
+
+// watchMaxWait bounds how long a steady stream of events can put off a
+// re-scan, so a long copy shows up while it is still going on.
+const watchMaxWait = 30 * time.Second
+
+type changeKind int
+
+const (
+	libraryChange changeKind = iota
+	vaultChange
+	collectionChange
+	galleryChange
+	actorChange
+)
+
+// change identifies the smallest part of the library that has to be
+// re-scanned after a filesystem event.
+type change struct {
+	kind  changeKind
+	vault string
+	name  string
+}
+
+type fsEvent struct {
+	path  string
+	isDir bool
+
+	// created is set when the path appeared (created or moved in),
+	// which is when new directories need to be watched.
+	created bool
+
+	// overflow is set when the kernel dropped events and we can no
+	// longer tell what changed.
+	overflow bool
+}
+
+type watcher struct {
+	ctx      context.Context
+	library  Library
+	opts     Options
+	store    db.Store
+	notifier *notifier
+	pending  map[change]struct{}
+
+	// report collects the scan issues of the current flush.
+	report *ScanReport
+
+	// ignore and layouts hold the ignore files and the vaults as of
+	// the last flush.
+	ignore  *ignorer
+	layouts map[string]vaultLayout
+}
+
+// Watch observes the vaults of the library and incrementally re-scans and
+// syncs the collections, galleries and actors that change on disk.
+// It blocks until ctx is cancelled or the watcher fails.
+func Watch(ctx context.Context, library Library, opts Options, store db.Store) error {
+	n, err := newNotifier()
+
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+
+	defer n.close()
+
+	w := &watcher{
+		ctx:      ctx,
+		library:  library,
+		opts:     opts,
+		store:    store,
+		notifier: n,
+		pending:  map[change]struct{}{},
+	}
+
+	w.refresh()
+
+	// Roots are only watched for their ignore files, everything
+	// else in them that matters is watched on its own.
+	for _, root := range library.paths() {
+		if err := n.add(root); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println("watch error:", err)
+		}
+	}
+
+	paths := w.watchPaths()
+
+	for _, p := range paths {
+		w.watchTree(p)
+	}
+
+	n.start()
+
+	log.Printf("watching %v for changes", strings.Join(paths, ", "))
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	// firstPending is when the oldest change that hasn't been flushed
+	// yet came in.
+	var firstPending time.Time
+
+	for {
+		select {
+		case event := <-n.events:
+			if event.overflow {
+				w.rescanAll("watch events overflowed")
+				continue
+			}
+
+			// Changes to an ignore file are always picked up, whatever
+			// else is going on in ignored folders is not.
+			if filepath.Base(event.path) != ignoreFileName && w.ignore.ignored(event.path, event.isDir) {
+				continue
+			}
+
+			c, ok := w.classify(event.path)
+
+			if !ok {
+				continue
+			}
+
+			if event.isDir && event.created {
+				w.watchTree(event.path)
+			}
+
+			if len(w.pending) == 0 {
+				firstPending = time.Now()
+			}
+
+			w.pending[c] = struct{}{}
+			timer.Reset(debounceDelay(firstPending, time.Now()))
+
+		case err := <-n.errors:
+			return fmt.Errorf("watcher failed: %w", err)
+
+		case <-ctx.Done():
+			return nil
+
+		case <-timer.C:
+			w.flush()
+		}
+	}
+}
+
+// debounceDelay is how long to wait for more events before flushing the
+// changes pending since firstPending.
+func debounceDelay(firstPending time.Time, now time.Time) time.Duration {
+	return min(watchDebounce, firstPending.Add(watchMaxWait).Sub(now))
+}
+
+// watchTree adds a watch for path and every directory below it. A
+// directory that can't be watched, say because it can't be read or
+// inotify ran out of watches, is logged and left out along with what is
+// below it, so the rest of the library is still watched.
+func (w *watcher) watchTree(path string) {
+	filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			// The directory may already be gone again by the time
+			// we get to it, which is not worth logging.
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Println("watch error:", err)
+			}
+
+			return nil
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if err := w.notifier.add(p); err != nil {
+			log.Println("watch error:", err)
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+}
+
+// refresh re-reads the ignore files and where the vaults are. The last
+// known vaults are kept when the library can't be read.
+func (w *watcher) refresh() {
+	w.ignore = newIgnorer(w.library.paths()...)
+	layouts, err := w.library.vaults(w.ignore)
+
+	if err != nil {
+		log.Println("watch error:", err)
+		return
+	}
+
+	w.layouts = map[string]vaultLayout{}
+
+	for _, l := range layouts {
+		w.layouts[l.name] = l
+	}
+}
+
+// watchPaths lists the folders to watch: the folders vaults are discovered
+// in and the videos, pictures and actors of every vault, without the ones
+// that are already in another.
+func (w *watcher) watchPaths() []string {
+	candidates := w.library.discoverPaths()
+
+	for _, l := range w.layouts {
+		candidates = append(candidates, l.videos, l.pictures, l.actors)
+	}
+
+	var paths []string
+
+	for _, p := range candidates {
+		nested := false
+
+		for _, other := range candidates {
+			if other != p && within(other, p) {
+				nested = true
+				break
+			}
+		}
+
+		if !nested && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
+
+// classify maps a path in the library to the part of it that has to be
+// re-scanned. Within a vault, the layout is:
+//
+//	<videos>/<collection>/...
+//	<actors>/<photo or .nfo>
+//	<pictures>/<gallery>/...
+func (w *watcher) classify(path string) (change, bool) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+
+	// The ignore file of a root or of a folder of vaults applies to
+	// every vault.
+	if base == ignoreFileName && (slices.Contains(w.library.paths(), dir) || slices.Contains(w.library.discoverPaths(), dir)) {
+		return change{kind: libraryChange}, true
+	}
+
+	// Folders that appear in a folder of vaults are new vaults, the
+	// ones that disappear are gone.
+	for _, d := range w.library.discoverPaths() {
+		parts, ok := relParts(d, path)
+
+		if !ok || len(parts) == 0 {
+			continue
+		}
+
+		if _, known := w.layouts[parts[0]]; !known || len(parts) == 1 {
+			return change{kind: vaultChange, vault: parts[0]}, true
+		}
+	}
+
+	for _, v := range w.layouts {
+		// Any other ignore file is re-read with the vault it
+		// belongs to.
+		if base == ignoreFileName && v.contains(path) {
+			return change{kind: vaultChange, vault: v.name}, true
+		}
+
+		// Actors go first, as they are usually among the pictures.
+		if parts, ok := relParts(v.actors, path); ok {
+			if len(parts) == 0 {
+				return change{kind: vaultChange, vault: v.name}, true
+			}
+
+			return change{kind: actorChange, vault: v.name, name: parts[0]}, true
+		}
+
+		if parts, ok := relParts(v.pictures, path); ok {
+			if len(parts) == 0 {
+				return change{kind: vaultChange, vault: v.name}, true
+			}
+
+			return change{kind: galleryChange, vault: v.name, name: parts[0]}, true
+		}
+
+		if parts, ok := relParts(v.videos, path); ok {
+			if len(parts) == 0 {
+				return change{kind: vaultChange, vault: v.name}, true
+			}
+
+			return change{kind: collectionChange, vault: v.name, name: parts[0]}, true
+		}
+
+		if path == v.path {
+			return change{kind: vaultChange, vault: v.name}, true
+		}
+	}
+
+	return change{}, false
+}
+
+// relParts splits path relative to dir. It is not ok when path is not
+// within dir and empty when it is dir itself.
+func relParts(dir string, path string) ([]string, bool) {
+	if !within(dir, path) {
+		return nil, false
+	}
+
+	rel, err := filepath.Rel(dir, path)
+
+	if err != nil {
+		return nil, false
+	}
+
+	if rel == "." {
+		return nil, true
+	}
+
+	return strings.Split(rel, string(filepath.Separator)), true
+}
+
+// contains reports whether path is in the vault or any of its folders.
+func (v vaultLayout) contains(path string) bool {
+	for _, dir := range []string{v.path, v.videos, v.pictures, v.actors} {
+		if within(dir, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flush re-syncs everything that changed since the last flush. A change
+// to a whole vault supersedes the finer grained changes within it.
+func (w *watcher) flush() {
+	if _, ok := w.pending[change{kind: libraryChange}]; ok {
+		w.rescanAll("an ignore file of the library changed")
+		return
+	}
+
+	w.report = newScanReport()
+	w.refresh()
+	vaults := map[string]bool{}
+
+	for c := range w.pending {
+		if c.kind == vaultChange {
+			vaults[c.vault] = true
+		}
+	}
+
+	for c := range w.pending {
+		if c.kind != vaultChange && vaults[c.vault] {
+			continue
+		}
+
+		if err := w.apply(c); err != nil {
+			log.Println("watch sync error:", err)
+		}
+	}
+
+	w.pending = map[change]struct{}{}
+	w.report.finish()
+
+	if err := SyncReport(w.ctx, w.report, w.store); err != nil {
+		log.Println("scan report sync error:", err)
+	}
+}
+
+func (w *watcher) apply(c change) error {
+	switch c.kind {
+	case vaultChange:
+		return w.syncVault(c.vault)
+	case collectionChange:
+		return w.syncCollection(c.vault, c.name)
+	case galleryChange:
+		return w.syncGallery(c.vault, c.name)
+	case actorChange:
+		return w.syncActor(c.vault, c.name)
+	}
+
+	return nil
+}
+
+// rescanAll scans and syncs the whole library, for when why says the
+// pending changes can't be narrowed down to parts of it.
+func (w *watcher) rescanAll(why string) {
+	log.Printf("%v, re-scanning the library", why)
+
+	world, scanReport, err := Scan(w.ctx, w.library, w.opts, w.store)
+
+	if err := SyncReport(w.ctx, scanReport, w.store); err != nil {
+		log.Println("scan report sync error:", err)
+	}
+
+	if err != nil {
+		log.Println("scan error:", err)
+		return
+	}
+
+	if err := Sync(w.ctx, world, w.store); err != nil {
+		log.Println("sync error:", err)
+	}
+
+	report, err := Reconcile(w.ctx, world, w.store)
+
+	if err != nil {
+		log.Println("reconcile error:", err)
+	}
+
+	logPruned(report)
+
+	w.pending = map[change]struct{}{}
+	w.refresh()
+}
+
+// commit runs fn in a transaction, so the API sees a change either
+// completely or not at all, and logs what was pruned once it is in.
+func (w *watcher) commit(fn func(tx db.Store, report *PruneReport) error) error {
+	var report PruneReport
+
+	err := w.store.InTx(w.ctx, func(tx db.Store) error {
+		return fn(tx, &report)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	logPruned(report)
+
+	return nil
+}
+
+func (w *watcher) syncVault(name string) error {
+	layout, ok := w.layouts[name]
+
+	if !ok {
+		names := make([]string, 0, len(w.layouts))
+
+		for n := range w.layouts {
+			names = append(names, n)
+		}
+
+		return w.commit(func(tx db.Store, report *PruneReport) error {
+			var err error
+
+			report.Vaults, err = tx.DeleteVaultsExcept(w.ctx, names)
+
+			if err != nil {
+				return err
+			}
+
+			return w.pruneOrphans(report, tx)
+		})
+	}
+
+	log.Printf("re-scanning vault %v", name)
+
+	vaultStates, err := newScanRun(w.ctx, w.library, w.opts, w.report, w.store).vaults([]vaultLayout{layout})
+
+	if err != nil {
+		return err
+	}
+
+	vaultState := vaultStates[0]
+
+	return w.commit(func(tx db.Store, report *PruneReport) error {
+		if err := syncVault(w.ctx, vaultState, tx); err != nil {
+			return err
+		}
+
+		if err := reconcileVault(w.ctx, vaultState, report, tx); err != nil {
+			return err
+		}
+
+		return w.pruneOrphans(report, tx)
+	})
+}
+
+func (w *watcher) syncCollection(vault string, slug string) error {
+	layout, ok := w.layouts[vault]
+
+	if !ok {
+		return nil
+	}
+
+	vaultVideosPath := layout.videos
+	collectionPath := filepath.Join(vaultVideosPath, slug)
+
+	if !w.present(collectionPath) {
+		collections, err := scanCollections(vaultVideosPath, w.ignore)
+
+		if !scanned(err) {
+			return err
+		}
+
+		names := make([]string, 0, len(collections))
+
+		for _, c := range collections {
+			names = append(names, c.Name)
+		}
+
+		return w.commit(func(tx db.Store, report *PruneReport) error {
+			vaultID, err := syncVaultID(w.ctx, vault, tx)
+
+			if err != nil {
+				return err
+			}
+
+			report.Collections, err = tx.DeleteCollectionsExcept(w.ctx, vaultID, names)
+
+			if err != nil {
+				return err
+			}
+
+			return w.pruneOrphans(report, tx)
+		})
+	}
+
+	log.Printf("re-scanning collection %v (vault: %v)", slug, vault)
+
+	collectionStates, err := newScanRun(w.ctx, w.library, w.opts, w.report, w.store).collections([]db.Collection{{
+		Name: utils.SnakeToTitle(slug),
+		Slug: slug,
+		Path: collectionPath,
+	}})
+
+	if err != nil {
+		return err
+	}
+
+	cs := collectionStates[0]
+
+	if !cs.videosScanned {
+		return fmt.Errorf("failed to read collection %v", collectionPath)
+	}
+
+	return w.commit(func(tx db.Store, report *PruneReport) error {
+		vaultID, err := syncVaultID(w.ctx, vault, tx)
+
+		if err != nil {
+			return err
+		}
+
+		cs.Collection.VaultID = vaultID
+
+		dbCollections, err := SyncCollections(w.ctx, []db.Collection{cs.Collection}, tx)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range cs.Videos {
+			cs.Videos[i].CollectionID = dbCollections[0].ID
+		}
+
+		if err := SyncVideos(w.ctx, cs.Videos, tx); err != nil {
+			return err
+		}
+
+		if err := reconcileCollection(w.ctx, vaultID, cs, report, tx); err != nil {
+			return err
+		}
+
+		return w.pruneOrphans(report, tx)
+	})
+}
+
+func (w *watcher) syncGallery(vault string, name string) error {
+	layout, ok := w.layouts[vault]
+
+	if !ok {
+		return nil
+	}
+
+	picturePath := layout.pictures
+	galleryPath := filepath.Join(picturePath, name)
+
+	// Files next to the galleries that aren't archives are not
+	// galleries at all.
+	info, err := os.Stat(galleryPath)
+
+	if err == nil && !info.IsDir() && !isArchive(name) {
+		return nil
+	}
+
+	// Only the re-scanned gallery is reconciled, the other
+	// galleries of the vault are kept as they are.
+	others, err := w.otherGalleries(layout, name)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists(galleryPath) || w.ignore.ignored(galleryPath, !isArchive(name)) {
+		return w.commit(func(tx db.Store, report *PruneReport) error {
+			vaultID, err := syncVaultID(w.ctx, vault, tx)
+
+			if err != nil {
+				return err
+			}
+
+			return reconcileGalleries(w.ctx, vaultID, nil, others, report, tx)
+		})
+	}
+
+	log.Printf("re-scanning gallery %v (vault: %v)", name, vault)
+
+	galleries, skipped, err := newScanRun(w.ctx, w.library, w.opts, w.report, w.store).gallery(picturePath, name)
+
+	if err != nil {
+		w.report.fail(galleryPath, err)
+		return err
+	}
+
+	slugs := make([]string, 0, len(galleries))
+
+	for _, g := range galleries {
+		slugs = append(slugs, g.Slug)
+	}
+
+	return w.commit(func(tx db.Store, report *PruneReport) error {
+		vaultID, err := syncVaultID(w.ctx, vault, tx)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range galleries {
+			galleries[i].VaultID = vaultID
+		}
+
+		if err := SyncGalleries(w.ctx, galleries, tx); err != nil {
+			return err
+		}
+
+		return reconcileGalleries(w.ctx, vaultID, slugs, append(skipped, others...), report, tx)
+	})
+}
+
+// otherGalleries returns the slugs of the top level galleries of a vault
+// except the one named name.
+func (w *watcher) otherGalleries(layout vaultLayout, name string) ([]string, error) {
+	names, err := listGalleries(layout.pictures, layout.actors, w.ignore)
+
+	if !scanned(err) {
+		return nil, err
+	}
+
+	var slugs []string
+
+	for _, n := range names {
+		if n != name {
+			slugs = append(slugs, n)
+		}
+	}
+
+	return slugs, nil
+}
+
+// syncActor re-reads the actor a changed photo or .nfo belongs to. An
+// actor left with neither is pruned when no video mentions them.
+func (w *watcher) syncActor(vault string, fileName string) error {
+	layout, ok := w.layouts[vault]
+
+	if !ok {
+		return nil
+	}
+
+	slug := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	files, err := listActors(layout.actors, w.ignore)
+
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.slug == slug {
+			log.Printf("re-scanning actor %v (vault: %v)", slug, vault)
+
+			actor := newScanRun(w.ctx, w.library, w.opts, w.report, w.store).readActor(layout.actors, f)
+
+			return w.commit(func(tx db.Store, report *PruneReport) error {
+				return SyncActors(w.ctx, []db.Actor{actor}, tx)
+			})
+		}
+	}
+
+	return w.commit(func(tx db.Store, report *PruneReport) error {
+		return w.pruneOrphans(report, tx)
+	})
+}
+
+// pruneOrphans removes the tags and actors left behind by a change.
+func (w *watcher) pruneOrphans(report *PruneReport, store db.Store) error {
+	world, err := scanAllActors(w.library)
+
+	if err != nil {
+		return err
+	}
+
+	return pruneOrphans(w.ctx, world, report, store)
+}
+
+func logPruned(report PruneReport) {
+	log.Printf("pruned %v", report)
+}
+
+// present reports whether a folder exists and is not ignored.
+func (w *watcher) present(path string) bool {
+	return exists(path) && !w.ignore.ignored(path, true)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
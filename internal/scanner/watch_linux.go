@@ -0,0 +1,231 @@
+//go:build linux
+
+package scanner
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE |
+	syscall.IN_DELETE |
+	syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF |
+	syscall.IN_MOVE_SELF
+
+// notifier is a thin wrapper around inotify. inotify watches are not
+// recursive, so every directory has to be added on its own.
+type notifier struct {
+	fd     int
+	events chan fsEvent
+	errors chan error
+
+	// run waits for the inotify descriptor and the read end of wake
+	// in epfd, so close can stop it by writing to wake.
+	epfd    int
+	wake    [2]int
+	done    chan struct{}
+	running sync.WaitGroup
+
+	mu      sync.Mutex
+	watches map[int]string
+}
+
+func newNotifier() (n *notifier, err error) {
+	n = &notifier{
+		fd:      -1,
+		events:  make(chan fsEvent, 256),
+		errors:  make(chan error, 1),
+		epfd:    -1,
+		wake:    [2]int{-1, -1},
+		done:    make(chan struct{}),
+		watches: map[int]string{},
+	}
+
+	defer func() {
+		if err != nil {
+			n.closeFds()
+		}
+	}()
+
+	n.fd, err = syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+
+	if err != nil {
+		return nil, fmt.Errorf("inotify init failed: %w", err)
+	}
+
+	if err := syscall.Pipe2(n.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return nil, fmt.Errorf("inotify wake pipe failed: %w", err)
+	}
+
+	n.epfd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+
+	if err != nil {
+		return nil, fmt.Errorf("inotify epoll failed: %w", err)
+	}
+
+	for _, fd := range []int{n.fd, n.wake[0]} {
+		event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+
+		if err := syscall.EpollCtl(n.epfd, syscall.EPOLL_CTL_ADD, fd, &event); err != nil {
+			return nil, fmt.Errorf("inotify epoll failed: %w", err)
+		}
+	}
+
+	return n, nil
+}
+
+func (n *notifier) add(path string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, path, watchMask)
+
+	if err != nil {
+		return fmt.Errorf("failed to watch %v: %w", path, err)
+	}
+
+	n.mu.Lock()
+	n.watches[wd] = path
+	n.mu.Unlock()
+
+	return nil
+}
+
+// start reads events from the kernel in the background until close.
+func (n *notifier) start() {
+	n.running.Add(1)
+
+	go func() {
+		defer n.running.Done()
+		n.run()
+	}()
+}
+
+func (n *notifier) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	ready := make([]syscall.EpollEvent, 2)
+
+	for {
+		count, err := syscall.EpollWait(n.epfd, ready, -1)
+
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil {
+			n.fail(err)
+			return
+		}
+
+		for _, event := range ready[:count] {
+			if int(event.Fd) == n.wake[0] {
+				return
+			}
+		}
+
+		count, err = syscall.Read(n.fd, buf)
+
+		if err == syscall.EINTR || err == syscall.EAGAIN {
+			continue
+		}
+
+		if err != nil {
+			n.fail(err)
+			return
+		}
+
+		offset := 0
+
+		for offset+syscall.SizeofInotifyEvent <= count {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+
+			if !n.dispatch(int(raw.Wd), raw.Mask, cString(buf[nameStart:nameEnd])) {
+				return
+			}
+
+			offset = nameEnd
+		}
+	}
+}
+
+// fail hands err to the watcher, unless it has stopped listening.
+func (n *notifier) fail(err error) {
+	select {
+	case n.errors <- err:
+	case <-n.done:
+	}
+}
+
+// send hands event to the watcher. It is not ok once the watcher has
+// stopped listening.
+func (n *notifier) send(event fsEvent) bool {
+	select {
+	case n.events <- event:
+		return true
+	case <-n.done:
+		return false
+	}
+}
+
+func (n *notifier) dispatch(wd int, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		return n.send(fsEvent{overflow: true})
+	}
+
+	n.mu.Lock()
+	dir, ok := n.watches[wd]
+
+	// The kernel drops the watch itself once the directory is gone.
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.watches, wd)
+	}
+	n.mu.Unlock()
+
+	if !ok || mask&syscall.IN_IGNORED != 0 {
+		return true
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+
+	return n.send(fsEvent{
+		path:    path,
+		isDir:   mask&syscall.IN_ISDIR != 0,
+		created: mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0,
+	})
+}
+
+// close stops run and waits for it to return before releasing the
+// descriptors, so none of them is closed while it is still in use.
+func (n *notifier) close() {
+	close(n.done)
+	syscall.Write(n.wake[1], []byte{0})
+	n.running.Wait()
+	n.closeFds()
+}
+
+func (n *notifier) closeFds() {
+	for _, fd := range []int{n.fd, n.epfd, n.wake[0], n.wake[1]} {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+	}
+}
+
+// cString trims the NUL padding inotify appends to event names.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
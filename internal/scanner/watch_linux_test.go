@@ -0,0 +1,48 @@
+//go:build linux
+
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifierCloseStopsRun(t *testing.T) {
+	n, err := newNotifier()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	if err := n.add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	n.start()
+
+	// Nobody reads the events, so run ends up waiting to hand one
+	// over.
+	for i := 0; i < cap(n.events)+10; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file_%d", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan struct{})
+
+	go func() {
+		n.close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not stop the notifier")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package scanner
+
+import "errors"
+
+// notifier is only implemented on Linux, where the library is
+// watched through inotify.
+type notifier struct {
+	events chan fsEvent
+	errors chan error
+}
+
+func newNotifier() (*notifier, error) {
+	return nil, errors.New("watching the library is only supported on linux")
+}
+
+func (n *notifier) add(path string) error { return nil }
+
+func (n *notifier) start() {}
+
+func (n *notifier) close() {}
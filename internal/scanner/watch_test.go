@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	root := buildTestLibrary(t)
+	w := &watcher{library: DefaultLibrary(root)}
+	w.refresh()
+
+	vaults := filepath.Join(root, "vaults")
+	home := filepath.Join(vaults, "home")
+
+	tests := []struct {
+		path string
+		want change
+		ok   bool
+	}{
+		{filepath.Join(root, ignoreFileName), change{kind: libraryChange}, true},
+		{filepath.Join(vaults, ignoreFileName), change{kind: libraryChange}, true},
+		{filepath.Join(vaults, "work"), change{kind: vaultChange, vault: "work"}, true},
+		{filepath.Join(vaults, "work", "videos", "movies"), change{kind: vaultChange, vault: "work"}, true},
+		{home, change{kind: vaultChange, vault: "home"}, true},
+		{filepath.Join(home, "videos"), change{kind: vaultChange, vault: "home"}, true},
+		{filepath.Join(home, "videos", "movies", ignoreFileName), change{kind: vaultChange, vault: "home"}, true},
+		{filepath.Join(home, "videos", "movies", "the_film", "the_film.nfo"), change{kind: collectionChange, vault: "home", name: "movies"}, true},
+		{filepath.Join(home, "pictures", "holiday", "day_two", "pier.png"), change{kind: galleryChange, vault: "home", name: "holiday"}, true},
+		{filepath.Join(home, "pictures", "actors", "jane_doe.nfo"), change{kind: actorChange, vault: "home", name: "jane_doe.nfo"}, true},
+		{filepath.Join(root, "elsewhere", "file.txt"), change{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := w.classify(test.path)
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("classify(%v) = %+v, %v, want %+v, %v", test.path, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestDebounceDelay(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		// A quiet library waits the whole debounce.
+		{start, watchDebounce},
+		{start.Add(watchMaxWait - time.Minute), watchDebounce},
+
+		// A steady stream of events is flushed once the oldest one
+		// has waited long enough.
+		{start.Add(watchMaxWait - time.Second), time.Second},
+		{start.Add(watchMaxWait), 0},
+		{start.Add(watchMaxWait + time.Second), -time.Second},
+	}
+
+	for _, test := range tests {
+		if got := debounceDelay(start, test.now); got != test.want {
+			t.Errorf("debounceDelay after %v = %v, want %v", test.now.Sub(start), got, test.want)
+		}
+	}
+}
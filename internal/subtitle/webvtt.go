@@ -0,0 +1,270 @@
+// Package subtitle converts subtitle sidecars to WebVTT, the only format
+// HTML5 players understand.
+package subtitle
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+type cue struct {
+	start int // milliseconds
+	end   int
+	text  string
+}
+
+// srtTiming matches the timing line of an SRT cue. Some encoders drop
+// the milliseconds or use a dot instead of a comma.
+var srtTiming = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})(?:[,.](\d{1,3}))?\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})(?:[,.](\d{1,3}))?`)
+
+// assOverride matches the {\...} style overrides of ASS, which also show
+// up in SRT files converted from ASS.
+var assOverride = regexp.MustCompile(`\{\\[^}]*\}`)
+
+// srtFont matches the font tags of SRT, which WebVTT doesn't have.
+var srtFont = regexp.MustCompile(`(?i)</?font[^>]*>`)
+
+// ToWebVTT converts a subtitle file in the given format (srt, vtt, ass or
+// ssa) to WebVTT.
+func ToWebVTT(format string, data []byte) ([]byte, error) {
+	text, err := decode(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var cues []cue
+
+	switch format {
+	case "vtt":
+		if !strings.HasPrefix(text, "WEBVTT") {
+			return nil, fmt.Errorf("missing WEBVTT header")
+		}
+
+		return []byte(text), nil
+
+	case "srt":
+		cues = parseSRT(text)
+
+	case "ass", "ssa":
+		cues, err = parseASS(text)
+
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported subtitle format %q", format)
+	}
+
+	var b strings.Builder
+
+	b.WriteString("WEBVTT\n")
+
+	for _, c := range cues {
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n", timestamp(c.start), timestamp(c.end), c.text)
+	}
+
+	return []byte(b.String()), nil
+}
+
+// decode returns the text of a subtitle file. Files that aren't UTF-8 are
+// either UTF-16 with a byte order mark or, more often, Windows-1252.
+func decode(data []byte) (string, error) {
+	if utf8.Valid(data) {
+		return strings.TrimPrefix(string(data), "\uFEFF"), nil
+	}
+
+	out, _, err := transform.Bytes(unicode.BOMOverride(charmap.Windows1252.NewDecoder()), data)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to decode subtitle: %w", err)
+	}
+
+	return string(out), nil
+}
+
+func parseSRT(text string) []cue {
+	var cues []cue
+
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		// The cue number is optional in practice, so look for the
+		// timing line in the first two lines.
+		for i := 0; i < len(lines) && i < 2; i++ {
+			match := srtTiming.FindStringSubmatch(lines[i])
+
+			if match == nil {
+				continue
+			}
+
+			body := strings.Join(lines[i+1:], "\n")
+			body = assOverride.ReplaceAllString(body, "")
+			body = srtFont.ReplaceAllString(body, "")
+
+			cues = append(cues, cue{
+				start: milliseconds(match[1], match[2], match[3], match[4], 3),
+				end:   milliseconds(match[5], match[6], match[7], match[8], 3),
+				text:  cueText(body),
+			})
+
+			break
+		}
+	}
+
+	return cues
+}
+
+// parseASS reads the dialogue events of an ASS or SSA script. Styling is
+// dropped, only the text and its timing are kept.
+func parseASS(text string) ([]cue, error) {
+	var cues []cue
+	var fields []string
+	inEvents := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Format":
+			fields = strings.Split(value, ",")
+
+			for i := range fields {
+				fields[i] = strings.TrimSpace(fields[i])
+			}
+
+		case "Dialogue":
+			if fields == nil {
+				return nil, fmt.Errorf("dialogue before the events format")
+			}
+
+			// Text is the last field and may itself contain commas.
+			values := strings.SplitN(strings.TrimSpace(value), ",", len(fields))
+
+			if len(values) != len(fields) {
+				continue
+			}
+
+			var c cue
+			var err error
+
+			for i, field := range fields {
+				switch field {
+				case "Start":
+					c.start, err = assTime(values[i])
+				case "End":
+					c.end, err = assTime(values[i])
+				case "Text":
+					c.text = assText(values[i])
+				}
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if c.text != "" {
+				cues = append(cues, c)
+			}
+		}
+	}
+
+	// WebVTT wants cues in start order, ASS doesn't care.
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+
+	return cues, nil
+}
+
+// assTime parses an ASS timestamp, which is h:mm:ss.cc.
+func assTime(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	seconds, fraction, _ := strings.Cut(parts[2], ".")
+
+	return milliseconds(parts[0], parts[1], seconds, fraction, 2), nil
+}
+
+func assText(value string) string {
+	value = assOverride.ReplaceAllString(value, "")
+	value = strings.ReplaceAll(value, `\N`, "\n")
+	value = strings.ReplaceAll(value, `\n`, "\n")
+	value = strings.ReplaceAll(value, `\h`, " ")
+
+	return cueText(value)
+}
+
+// cueText makes sure the text of a cue can't end the cue early.
+func cueText(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.ReplaceAll(text, "-->", "->")
+
+	for strings.Contains(text, "\n\n") {
+		text = strings.ReplaceAll(text, "\n\n", "\n")
+	}
+
+	return text
+}
+
+// milliseconds adds up a timestamp whose fraction has up to the given
+// number of digits, 3 in SRT and 2 in ASS. A shorter fraction is still a
+// decimal, so "5" is 500ms in both, and a longer one is cut short.
+func milliseconds(hours, minutes, seconds, fraction string, digits int) int {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+
+	ms := 0
+
+	if fraction != "" {
+		fraction = fraction[:min(len(fraction), digits)]
+
+		for len(fraction) < digits {
+			fraction += "0"
+		}
+
+		ms, _ = strconv.Atoi(fraction)
+
+		for ; digits < 3; digits++ {
+			ms *= 10
+		}
+	}
+
+	return ((h*60+m)*60+s)*1000 + ms
+}
+
+func timestamp(ms int) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,142 @@
+package subtitle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseSRT(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []cue
+	}{
+		{
+			name: "numbered cues",
+			text: "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			want: []cue{{1000, 2500, "Hello"}, {3000, 4000, "Two\nlines"}},
+		},
+		{
+			name: "without numbers",
+			text: "00:00:01,000 --> 00:00:02,000\nHello\n",
+			want: []cue{{1000, 2000, "Hello"}},
+		},
+		{
+			name: "dots and short fractions",
+			text: "1\n01:02:03.5 --> 01:02:04\nHello\n",
+			want: []cue{{3723500, 3724000, "Hello"}},
+		},
+		{
+			name: "tags from other formats",
+			text: "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<font color=\"red\">Hello</font> --> there\n",
+			want: []cue{{1000, 2000, "Hello -> there"}},
+		},
+		{
+			name: "blocks without timing",
+			text: "garbage\n\n1\n00:00:01,000 --> 00:00:02,000\nHello\n",
+			want: []cue{{1000, 2000, "Hello"}},
+		},
+	}
+
+	for _, test := range tests {
+		got := parseSRT(test.text)
+
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: parseSRT() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseASS(t *testing.T) {
+	const header = "[Script Info]\nTitle: Test\n\n[V4+ Styles]\nFormat: Name, Fontname\nStyle: Default,Arial\n\n[Events]\n"
+
+	tests := []struct {
+		name   string
+		text   string
+		want   []cue
+		hasErr bool
+	}{
+		{
+			name: "dialogue",
+			text: header + "Format: Layer, Start, End, Style, Text\nDialogue: 0,0:00:01.50,0:00:02.00,Default,Hello, world\n",
+			want: []cue{{1500, 2000, "Hello, world"}},
+		},
+		{
+			name: "fields in another order",
+			text: header + "Format: Start, Text, End\nDialogue: 0:00:01.00,Hello,0:00:02.00\n",
+			want: []cue{{1000, 2000, "Hello"}},
+		},
+		{
+			name: "overrides and line breaks",
+			text: header + "Format: Start, End, Text\nDialogue: 0:00:01.00,0:00:02.00,{\\i1}Hello{\\i0}\\Nthere\\hyou\n",
+			want: []cue{{1000, 2000, "Hello\nthere you"}},
+		},
+		{
+			name: "sorted by start",
+			text: header + "Format: Start, End, Text\nDialogue: 0:00:03.00,0:00:04.00,Second\nDialogue: 0:00:01.00,0:00:02.00,First\n",
+			want: []cue{{1000, 2000, "First"}, {3000, 4000, "Second"}},
+		},
+		{
+			name: "long fractions",
+			text: header + "Format: Start, End, Text\nDialogue: 0:00:01.123,0:00:02.5,Hello\n",
+			want: []cue{{1120, 2500, "Hello"}},
+		},
+		{
+			name: "empty and short dialogue",
+			text: header + "Format: Start, End, Text\nDialogue: 0:00:01.00,0:00:02.00,{\\pos(1,1)}\nDialogue: 0:00:01.00\n",
+			want: nil,
+		},
+		{
+			name:   "dialogue before the format",
+			text:   header + "Dialogue: 0:00:01.00,0:00:02.00,Hello\n",
+			hasErr: true,
+		},
+		{
+			name:   "invalid timestamp",
+			text:   header + "Format: Start, End, Text\nDialogue: 1.00,0:00:02.00,Hello\n",
+			hasErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseASS(test.text)
+
+		if (err != nil) != test.hasErr {
+			t.Errorf("%v: parseASS() error = %v, want error %v", test.name, err, test.hasErr)
+			continue
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: parseASS() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestToWebVTT(t *testing.T) {
+	got, err := ToWebVTT("srt", []byte("\uFEFF1\r\n00:00:01,000 --> 01:00:02,003\r\nCafé\r\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "WEBVTT\n\n00:00:01.000 --> 01:00:02.003\nCafé\n"
+
+	if string(got) != want {
+		t.Errorf("unexpected WebVTT %q", got)
+	}
+
+	// Files that aren't UTF-8 are read as Windows-1252.
+	got, err = ToWebVTT("srt", []byte("1\n00:00:01,000 --> 00:00:02,000\nCaf\xe9\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nCafé\n" {
+		t.Errorf("unexpected WebVTT %q", got)
+	}
+
+	if _, err := ToWebVTT("vtt", []byte("1\n00:00:01.000 --> 00:00:02.000\nHello\n")); err == nil {
+		t.Errorf("expected WebVTT without a header to be rejected")
+	}
+}
@@ -0,0 +1,232 @@
+// Package thumbnail generates and caches downscaled copies of gallery
+// images, actor photos and video posters so clients don't have to fetch
+// the originals just to render a grid.
+package thumbnail
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/sync/singleflight"
+)
+
+// Sizes are the presets thumbnails can be requested in, as the longest
+// side in pixels.
+var Sizes = map[string]int{
+	"small":  160,
+	"medium": 320,
+	"large":  640,
+}
+
+var (
+	ErrUnknownSize = errors.New("unknown thumbnail size")
+
+	// ErrUnsupported is returned for images in a format there is no
+	// decoder for, like HEIC.
+	ErrUnsupported = errors.New("unsupported image format")
+
+	// ErrTooLarge is returned for images with more than maxPixels
+	// pixels, which would take too much memory to decode.
+	ErrTooLarge = errors.New("image too large")
+)
+
+// jpegQuality is good enough for thumbnails while keeping them small.
+const jpegQuality = 85
+
+// maxPixels is the largest image thumbnails are made of. Decoding one
+// takes about four bytes a pixel.
+const maxPixels = 100_000_000
+
+var (
+	cacheDir string
+	group    singleflight.Group
+	keyRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+)
+
+// Source is an image to make thumbnails of. Key identifies it in the
+// cache and Open is only called when the thumbnail has to be generated.
+type Source struct {
+	Key     string
+	ModTime time.Time
+
+	// Orientation is the EXIF orientation of the image, which is
+	// applied to the thumbnail. Zero leaves the image as it is.
+	Orientation int
+
+	Open func() (io.ReadCloser, error)
+}
+
+// Init sets the directory thumbnails are cached in, creating it if needed.
+func Init(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create thumbnail cache: %w", err)
+	}
+
+	cacheDir = dir
+
+	return nil
+}
+
+// FileSource is a Source for an image file on disk.
+func FileSource(key string, path string, orientation int) (Source, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return Source{}, err
+	}
+
+	return Source{
+		Key:         key,
+		ModTime:     info.ModTime(),
+		Orientation: orientation,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// Get returns the path of the cached thumbnail of src in the given size,
+// generating it first when it is missing or older than the source.
+func Get(src Source, size string) (string, error) {
+	maxSize, ok := Sizes[size]
+
+	if !ok {
+		return "", ErrUnknownSize
+	}
+
+	if cacheDir == "" {
+		return "", fmt.Errorf("thumbnail cache is not initialised")
+	}
+
+	if !keyRegex.MatchString(src.Key) {
+		return "", fmt.Errorf("invalid thumbnail key %q", src.Key)
+	}
+
+	path := filepath.Join(cacheDir, src.Key+"_"+size)
+
+	if fresh(path, src.ModTime) {
+		return path, nil
+	}
+
+	// Concurrent requests for the same thumbnail share one generation.
+	_, err, _ := group.Do(path, func() (any, error) {
+		if fresh(path, src.ModTime) {
+			return nil, nil
+		}
+
+		return nil, generate(src, maxSize, path)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// fresh reports whether a cached thumbnail was generated from the source
+// as it is now. Thumbnails carry the mtime of their source.
+func fresh(path string, modTime time.Time) bool {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return false
+	}
+
+	return info.ModTime().Truncate(time.Second).Equal(modTime.Truncate(time.Second))
+}
+
+func generate(src Source, maxSize int, path string) error {
+	if err := checkSize(src); err != nil {
+		return err
+	}
+
+	rc, err := src.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	img, format, err := image.Decode(rc)
+
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumb := orient(resize(img, maxSize), src.Orientation)
+
+	// Write next to the final path and rename, so a thumbnail that is
+	// being generated is never served half written.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	// PNG and GIF keep their transparency, everything else
+	// becomes a JPEG.
+	if format == "png" || format == "gif" {
+		err = png.Encode(tmp, thumb)
+	} else {
+		err = jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: jpegQuality})
+	}
+
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(tmp.Name(), src.ModTime, src.ModTime); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkSize reads just the header of src to make sure it can be decoded
+// and isn't too large to.
+func checkSize(src Source) error {
+	rc, err := src.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	config, _, err := image.DecodeConfig(rc)
+
+	if errors.Is(err, image.ErrFormat) {
+		return ErrUnsupported
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return fmt.Errorf("%w: %vx%v", ErrTooLarge, config.Width, config.Height)
+	}
+
+	return nil
+}
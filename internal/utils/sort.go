@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NaturalLess compares strings the way people expect file names to be
+// ordered, with runs of digits compared by their value so "img2" comes
+// before "img10". Letters are compared without regard to case.
+func NaturalLess(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si := i
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+
+			sj := j
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+
+			na := strings.TrimLeft(string(ra[si:i]), "0")
+			nb := strings.TrimLeft(string(rb[sj:j]), "0")
+
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+
+			if na != nb {
+				return na < nb
+			}
+
+			continue
+		}
+
+		ca, cb := unicode.ToLower(ra[i]), unicode.ToLower(rb[j])
+
+		if ca != cb {
+			return ca < cb
+		}
+
+		i++
+		j++
+	}
+
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+
+	// Names that only differ in case or leading zeros still need a
+	// stable order.
+	return a < b
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"img2", "img10", true},
+		{"img10", "img2", false},
+		{"IMG1", "img2", true},
+		{"img02", "img2", true},
+		{"img2", "img02", false},
+		{"img", "img1", true},
+		{"img1", "img", false},
+		{"img1", "img1", false},
+		{"a100b", "a99c", false},
+		{"b", "A", false},
+	}
+
+	for _, test := range tests {
+		if got := NaturalLess(test.a, test.b); got != test.want {
+			t.Errorf("NaturalLess(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	names := []string{"page10.jpg", "Page2.jpg", "page1.jpg", "cover.jpg"}
+	slices.SortFunc(names, func(a, b string) int {
+		if NaturalLess(a, b) {
+			return -1
+		}
+
+		if NaturalLess(b, a) {
+			return 1
+		}
+
+		return 0
+	})
+
+	if want := []string{"cover.jpg", "page1.jpg", "Page2.jpg", "page10.jpg"}; !slices.Equal(names, want) {
+		t.Errorf("unexpected order %v", names)
+	}
+}